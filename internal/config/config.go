@@ -17,6 +17,67 @@ const (
 	// HelmChart is the key name used in the map to store Helm Chart name
 	HelmChart = "helm-chart"
 
+	// Forwarder is the key name used in the map to store the
+	// default forwarder of the NSM install
+	Forwarder = "forwarder"
+
+	// Forwarders is the key name used in the map to store the
+	// comma separated list of the available forwarders
+	Forwarders = "forwarders"
+
+	// VL3CIDR is the key name used in the map to store the
+	// default CIDR of the vL3 network
+	VL3CIDR = "cidr"
+
+	// VL3Replicas is the key name used in the map to store the
+	// default number of vL3 NSEs on each cluster
+	VL3Replicas = "replicas"
+
+	// IntegratedMesh is the key name used in the map to store the
+	// name of the service mesh NSM is integrated with
+	IntegratedMesh = "mesh"
+
+	// ImageRegistry is the key name used in the map to store the
+	// registry of the NSM images
+	ImageRegistry = "image-registry"
+
+	// DefaultImageRegistry is the registry the NSM images are published to
+	DefaultImageRegistry = "ghcr.io/networkservicemesh"
+
+	// MetricsPort is the key name used in the map to store the port
+	// the NSM components serve their Prometheus metrics on
+	MetricsPort = "metrics-port"
+
+	// DefaultMetricsPort is the port of the Prometheus metrics of the
+	// NSM components when their pods do not declare one
+	DefaultMetricsPort = "8081"
+
+	// MetricsSeries is the key name used in the map to store the comma
+	// separated list of the patterns of the collected metric series
+	MetricsSeries = "metrics-series"
+
+	// TestImage is the key name used in the map to store the image
+	// running the connectivity checks
+	TestImage = "test-image"
+
+	// DefaultTestImage is the image running the connectivity checks, it
+	// provides ping, ip and iperf3
+	DefaultTestImage = "nicolaka/netshoot:v0.11"
+
+	// NSMChart is the name of the Helm Chart of the NSM control plane
+	NSMChart = "nsm"
+
+	// NSMFloatingRegistryChart is the name of the Helm Chart of the
+	// floating interdomain registry
+	NSMFloatingRegistryChart = "floating-registry"
+
+	// ForwarderVPP is the name of the VPP forwarder profile
+	ForwarderVPP = "forwarder-vpp"
+	// ForwarderKernel is the name of the kernel forwarder profile
+	ForwarderKernel = "forwarder-kernel"
+	// DefaultForwarder is the forwarder used when none is requested
+	DefaultForwarder = ForwarderVPP
+
 	// NSMICMPResponderSampleApp is the name for the NSM ICMP Responder
 	// Sample Application
 	NSMICMPResponderSampleApp = "nsm-icmp-responder-sample-app"
@@ -25,6 +86,69 @@ const (
 	NSMVPPICMPResponderSampleApp = "nsm-vpp-icmp-responder-sample-app"
 	// NSMVPMSampleApp is the name for the NSM VPM Sample Application
 	NSMVPMSampleApp = "nsm-vpn-sample-app"
+
+	// NSMPreflightOperation is the name for the pre-flight checks
+	// which validate the clusters before installing NSM
+	NSMPreflightOperation = "nsm-preflight"
+
+	// NSMInterdomainOperation is the name for the install of NSM
+	// across the clusters as a federated interdomain topology
+	NSMInterdomainOperation = "nsm-interdomain"
+
+	// NSMFloatingRegistryOperation is the name for the deployment of the
+	// floating interdomain registry on one of the clusters
+	NSMFloatingRegistryOperation = "nsm-floating-registry"
+
+	// NSMVL3NetworkOperation is the name for the deployment of a
+	// virtual L3 network on a cluster
+	NSMVL3NetworkOperation = "nsm-vl3-network"
+
+	// NSMIstioOperation is the name for the install of NSM integrated
+	// with an existing Istio control plane
+	NSMIstioOperation = "nsm-istio"
+
+	// NSMDiffOperation is the name for the comparison of the live NSM
+	// objects on the clusters with the desired ones
+	NSMDiffOperation = "nsm-diff"
+
+	// NSMHistoryOperation is the name for the query of the operations
+	// and the installs recorded in the journal
+	NSMHistoryOperation = "nsm-history"
+
+	// NSMMetricsOperation is the name for the collection of the metrics
+	// of the NSM managers and forwarders
+	NSMMetricsOperation = "nsm-metrics"
+
+	// NSMInspectOperation is the name for the inspection of the topology
+	// of the network service connections
+	NSMInspectOperation = "nsm-inspect"
+
+	// NSMConnectivityOperation is the name for the test of the
+	// connectivity of a client to its network service endpoint
+	NSMConnectivityOperation = "nsm-connectivity"
+
+	// NSMBenchmarkOperation is the name for the benchmark of the
+	// kernel, memif and VPP datapaths
+	NSMBenchmarkOperation = "nsm-benchmark"
+
+	// NSMHealOperation is the name for the verification of the healing
+	// of a connection from the failures of its components
+	NSMHealOperation = "nsm-heal"
+
+	// NSMJaegerAddon is the name for the deployment of Jaeger collecting
+	// the traces of the NSM components
+	NSMJaegerAddon = "nsm-jaeger-addon"
+
+	// NSMPrometheusAddon is the name for the deployment of Prometheus
+	// scraping the metrics of the NSM components
+	NSMPrometheusAddon = "nsm-prometheus-addon"
+
+	// NSMGrafanaAddon is the name for the deployment of Grafana with the
+	// dashboard of the NSM data plane
+	NSMGrafanaAddon = "nsm-grafana-addon"
+
+	// journalFileName is the name of the file of the operation journal
+	journalFileName = "nsm-journal.db"
 )
 
 var (
@@ -34,6 +158,11 @@ var (
 
 	configRootPath = path.Join(utils.GetHome(), ".meshery")
 
+	// DefaultMetricsSeries are the patterns of the metric series collected
+	// from the NSM components: the connections, the heal events and the
+	// interface statistics of the forwarders
+	DefaultMetricsSeries = []string{"*connection*", "*heal*", "*_rx_*", "*_tx_*", "*interface*"}
+
 	// Config is the collection of ServerConfig, MeshConfig and ProviderConfig
 	Config = configprovider.Options{
 		ServerConfig:   ServerConfig,
@@ -110,3 +239,8 @@ func NewKubeconfigBuilder(provider string) (config.Handler, error) {
 func RootPath() string {
 	return configRootPath
 }
+
+// JournalPath returns the path of the operation journal of the adapter
+func JournalPath() string {
+	return path.Join(configRootPath, journalFileName)
+}
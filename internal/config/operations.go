@@ -1,6 +1,8 @@
 package config
 
 import (
+	"strings"
+
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-adapter-library/common"
 	"github.com/layer5io/meshery-adapter-library/meshes"
@@ -10,11 +12,63 @@ func getOperations(dev adapter.Operations) adapter.Operations {
 	versions, _ := getLatestReleaseNames(3)
 
 	dev[NSMMeshOperation] = &adapter.Operation{
-		Type:                 int32(meshes.OpCategory_INSTALL),
-		Description:          "NSM",
-		Versions:             versions,
-		Templates:            []adapter.Template{},
-		AdditionalProperties: map[string]string{},
+		Type:        int32(meshes.OpCategory_INSTALL),
+		Description: "NSM",
+		Versions:    versions,
+		Templates:   []adapter.Template{},
+		AdditionalProperties: map[string]string{
+			HelmChart:     NSMChart,
+			Forwarder:     DefaultForwarder,
+			Forwarders:    strings.Join([]string{ForwarderVPP, ForwarderKernel}, ","),
+			ImageRegistry: DefaultImageRegistry,
+		},
+	}
+
+	dev[NSMInterdomainOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_INSTALL),
+		Description: "NSM Interdomain",
+		Versions:    versions,
+		Templates:   []adapter.Template{},
+		AdditionalProperties: map[string]string{
+			HelmChart:  NSMChart,
+			Forwarder:  DefaultForwarder,
+			Forwarders: strings.Join([]string{ForwarderVPP, ForwarderKernel}, ","),
+		},
+	}
+
+	dev[NSMFloatingRegistryOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "NSM Floating Interdomain Registry",
+		Versions:    versions,
+		Templates:   []adapter.Template{},
+		AdditionalProperties: map[string]string{
+			HelmChart: NSMFloatingRegistryChart,
+			Forwarder: DefaultForwarder,
+		},
+	}
+
+	dev[NSMVL3NetworkOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "NSM vL3 Network",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			common.ServiceName: "vl3",
+			VL3CIDR:            "172.16.0.0/16",
+			VL3Replicas:        "2",
+		},
+	}
+
+	dev[NSMIstioOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_INSTALL),
+		Description: "NSM with Istio",
+		Versions:    versions,
+		Templates:   []adapter.Template{},
+		AdditionalProperties: map[string]string{
+			IntegratedMesh: "istio",
+			Forwarder:      DefaultForwarder,
+			TestImage:      DefaultTestImage,
+		},
 	}
 
 	dev[NSMICMPResponderSampleApp] = &adapter.Operation{
@@ -44,5 +98,108 @@ func getOperations(dev adapter.Operations) adapter.Operations {
 		},
 	}
 
+	dev[NSMDiffOperation] = &adapter.Operation{
+		Type:                 int32(meshes.OpCategory_VALIDATE),
+		Description:          "NSM Drift Diff",
+		Versions:             adapter.NoneVersion,
+		Templates:            adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{},
+	}
+
+	dev[NSMHistoryOperation] = &adapter.Operation{
+		Type:                 int32(meshes.OpCategory_VALIDATE),
+		Description:          "NSM Operation History",
+		Versions:             adapter.NoneVersion,
+		Templates:            adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{},
+	}
+
+	dev[NSMJaegerAddon] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Add-on: Jaeger",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			common.ServiceName: "jaeger",
+		},
+	}
+
+	dev[NSMPrometheusAddon] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Add-on: Prometheus",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			common.ServiceName: "prometheus",
+		},
+	}
+
+	dev[NSMGrafanaAddon] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Add-on: Grafana",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			common.ServiceName: "grafana",
+		},
+	}
+
+	dev[NSMBenchmarkOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "NSM Datapath Benchmark",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			TestImage: DefaultTestImage,
+		},
+	}
+
+	dev[NSMConnectivityOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "NSM Connectivity Test",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			TestImage: DefaultTestImage,
+		},
+	}
+
+	dev[NSMHealOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "NSM Heal Verification",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			TestImage: DefaultTestImage,
+		},
+	}
+
+	dev[NSMInspectOperation] = &adapter.Operation{
+		Type:                 int32(meshes.OpCategory_VALIDATE),
+		Description:          "NSM Connection Topology",
+		Versions:             adapter.NoneVersion,
+		Templates:            adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{},
+	}
+
+	dev[NSMMetricsOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "NSM Data Plane Metrics",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			MetricsPort:   DefaultMetricsPort,
+			MetricsSeries: strings.Join(DefaultMetricsSeries, ","),
+		},
+	}
+
+	dev[NSMPreflightOperation] = &adapter.Operation{
+		Type:                 int32(meshes.OpCategory_VALIDATE),
+		Description:          "NSM Pre-flight Checks",
+		Versions:             adapter.NoneVersion,
+		Templates:            adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{},
+	}
+
 	return dev
 }
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,8 +10,14 @@ import (
 	"sort"
 
 	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-nsm/internal/metrics"
+	"github.com/layer5io/meshery-nsm/internal/tracing"
+	"go.opentelemetry.io/otel/label"
 )
 
+// releasesAPIURL is the GitHub API listing the releases of the nsm mesh repository
+var releasesAPIURL = "https://api.github.com/repos/networkservicemesh/networkservicemesh/releases"
+
 // Release is used to save the release informations
 type Release struct {
 	ID      int             `json:"id,omitempty"`
@@ -63,16 +70,21 @@ func getLatestReleaseNames(limit int) ([]adapter.Version, error) {
 }
 
 // GetLatestReleases fetches the latest releases from the nsm mesh repository
-func GetLatestReleases(releases uint) ([]*Release, error) {
-	releaseAPIURL := "https://api.github.com/repos/networkservicemesh/networkservicemesh/releases?per_page=" + fmt.Sprint(releases)
+func GetLatestReleases(releases uint) (_ []*Release, err error) {
+	ctx, span := tracing.Start(context.Background(), "releases.fetch", label.Int("releases", int(releases)))
+	defer func() { tracing.End(ctx, span, err) }()
+
+	releaseAPIURL := releasesAPIURL + "?per_page=" + fmt.Sprint(releases)
 	// We need a variable url here hence using nosec
 	// #nosec
 	resp, err := http.Get(releaseAPIURL)
 	if err != nil {
+		metrics.FetchFailed(metrics.SourceGitHub)
 		return []*Release{}, ErrGetLatestReleases(err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		metrics.FetchFailed(metrics.SourceGitHub)
 		return []*Release{}, ErrGetLatestReleases(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
 	}
 
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/sdk/export/trace/tracetest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/codes"
+)
+
+func TestGetLatestReleasesSpan(t *testing.T) {
+	recorder := tracetest.NewInMemoryExporter()
+	provider, err := sdktrace.NewProvider(
+		sdktrace.WithConfig(sdktrace.Config{DefaultSampler: sdktrace.AlwaysSample()}),
+		sdktrace.WithSyncer(recorder),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	global.SetTraceProvider(provider)
+
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		releases int
+		code     codes.Code
+	}{
+		{
+			name:     "fetched",
+			status:   http.StatusOK,
+			body:     `[{"id": 1, "tag_name": "v1.6.0", "name": "v1.6.0"}, {"id": 2, "tag_name": "v1.5.0", "name": "v1.5.0"}]`,
+			releases: 2,
+			code:     codes.OK,
+		},
+		{
+			name:   "rate limited",
+			status: http.StatusForbidden,
+			code:   codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			defer func(url string) { releasesAPIURL = url }(releasesAPIURL)
+			releasesAPIURL = server.URL
+			recorder.Reset()
+
+			releases, err := GetLatestReleases(10)
+			if (err != nil) != (tt.code != codes.OK) {
+				t.Fatalf("GetLatestReleases() error = %v", err)
+			}
+			if len(releases) != tt.releases {
+				t.Errorf("GetLatestReleases() returned %d releases, want %d", len(releases), tt.releases)
+			}
+
+			sds := recorder.GetSpans()
+			if len(sds) != 1 {
+				t.Fatalf("recorded %d spans, want 1", len(sds))
+			}
+			sd := sds[0]
+			if sd.Name != "releases.fetch" || sd.ParentSpanID.IsValid() {
+				t.Errorf("recorded span %q with parent %v, want root span releases.fetch", sd.Name, sd.ParentSpanID)
+			}
+			if want := label.Int("releases", 10); len(sd.Attributes) != 1 || sd.Attributes[0] != want {
+				t.Errorf("attributes = %v, want [%v]", sd.Attributes, want)
+			}
+			if sd.StatusCode != tt.code {
+				t.Errorf("status = %v, want %v", sd.StatusCode, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Package health - Is the package for the liveness and readiness of the adapter
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Check returns an error when the dependency it checks is not ready
+type Check func() error
+
+// check is a named readiness check
+type check struct {
+	name  string
+	check Check
+}
+
+// Result is the outcome of a readiness check
+type Result struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// Checker runs the readiness checks of the adapter
+type Checker struct {
+	mx     sync.RWMutex
+	checks []check
+}
+
+// NewChecker returns a checker without any readiness check
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Add adds the named readiness check
+func (c *Checker) Add(name string, fn Check) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.checks = append(c.checks, check{name: name, check: fn})
+}
+
+// Ready runs the readiness checks and returns their results, the adapter
+// is ready when all of the checks pass
+func (c *Checker) Ready() ([]Result, bool) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+
+	ready := true
+	results := make([]Result, 0, len(c.checks))
+	for _, ch := range c.checks {
+		res := Result{Name: ch.name, Ready: true}
+		if err := ch.check(); err != nil {
+			res.Ready = false
+			res.Error = err.Error()
+			ready = false
+		}
+		results = append(results, res)
+	}
+	return results, ready
+}
+
+// Register registers the /healthz and /readyz endpoints on the mux. The
+// adapter is live as long as it serves the requests, /readyz responds
+// with the results of the readiness checks
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		results, ready := c.Ready()
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(struct {
+			Ready  bool     `json:"ready"`
+			Checks []Result `json:"checks"`
+		}{Ready: ready, Checks: results})
+	})
+}
+
+// ServeGRPC serves the gRPC health checking protocol at the address until
+// the context is done. The serving status of the overall server and of the
+// named service reflects the readiness checks, which are run at the interval
+func (c *Checker) ServeGRPC(ctx context.Context, addr, service string, interval time.Duration) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	hs := grpchealth.NewServer()
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, hs)
+
+	update := func() {
+		st := healthpb.HealthCheckResponse_SERVING
+		if _, ready := c.Ready(); !ready {
+			st = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		hs.SetServingStatus("", st)
+		hs.SetServingStatus(service, st)
+	}
+	update()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				hs.Shutdown()
+				server.GracefulStop()
+				return
+			case <-ticker.C:
+				update()
+			}
+		}
+	}()
+	return server.Serve(listener)
+}
@@ -0,0 +1,187 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name      string
+		checks    map[string]error
+		wantReady bool
+		want      []Result
+	}{
+		{
+			name:      "no checks",
+			wantReady: true,
+			want:      []Result{},
+		},
+		{
+			name:      "all checks pass",
+			checks:    map[string]error{"config": nil},
+			wantReady: true,
+			want:      []Result{{Name: "config", Ready: true}},
+		},
+		{
+			name:      "a check fails",
+			checks:    map[string]error{"releases": errors.New("rate limited")},
+			wantReady: false,
+			want:      []Result{{Name: "releases", Ready: false, Error: "rate limited"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker()
+			for name, err := range tt.checks {
+				err := err
+				c.Add(name, func() error { return err })
+			}
+			got, ready := c.Ready()
+			if ready != tt.wantReady {
+				t.Errorf("Ready() ready = %v, want %v", ready, tt.wantReady)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Ready() results = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadyAggregatesChecks(t *testing.T) {
+	c := NewChecker()
+	c.Add("config", func() error { return nil })
+	c.Add("kubeconfig", func() error { return errors.New("invalid kubeconfig") })
+	c.Add("releases", func() error { return nil })
+
+	got, ready := c.Ready()
+	if ready {
+		t.Error("Ready() ready = true, want false when one check fails")
+	}
+	want := []Result{
+		{Name: "config", Ready: true},
+		{Name: "kubeconfig", Ready: false, Error: "invalid kubeconfig"},
+		{Name: "releases", Ready: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Ready() results = %v, want %v", got, want)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var failing atomic.Bool
+	c := NewChecker()
+	c.Add("releases", func() error {
+		if failing.Load() {
+			return errors.New("rate limited")
+		}
+		return nil
+	})
+	mux := http.NewServeMux()
+	c.Register(mux)
+
+	tests := []struct {
+		name       string
+		path       string
+		failing    bool
+		wantStatus int
+		wantReady  bool
+	}{
+		{name: "live", path: "/healthz", wantStatus: http.StatusOK},
+		{name: "live while not ready", path: "/healthz", failing: true, wantStatus: http.StatusOK},
+		{name: "ready", path: "/readyz", wantStatus: http.StatusOK, wantReady: true},
+		{name: "not ready", path: "/readyz", failing: true, wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failing.Store(tt.failing)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s status = %d, want %d", tt.path, rec.Code, tt.wantStatus)
+			}
+			if tt.path != "/readyz" {
+				return
+			}
+			var body struct {
+				Ready  bool     `json:"ready"`
+				Checks []Result `json:"checks"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Ready != tt.wantReady || len(body.Checks) != 1 || body.Checks[0].Ready != tt.wantReady {
+				t.Errorf("/readyz body = %+v, want ready %v", body, tt.wantReady)
+			}
+		})
+	}
+}
+
+func TestServeGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	var failing atomic.Bool
+	c := NewChecker()
+	c.Add("releases", func() error {
+		if failing.Load() {
+			return errors.New("rate limited")
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- c.ServeGRPC(ctx, addr, "nsm-adapter", 10*time.Millisecond) }()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	waitStatus := func(service string, want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		var got healthpb.HealthCheckResponse_ServingStatus
+		for i := 0; i < 100; i++ {
+			res, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service}, grpc.WaitForReady(true))
+			if err == nil {
+				got = res.Status
+				if got == want {
+					return
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Errorf("status of %q = %v, want %v", service, got, want)
+	}
+
+	waitStatus("", healthpb.HealthCheckResponse_SERVING)
+	waitStatus("nsm-adapter", healthpb.HealthCheckResponse_SERVING)
+	failing.Store(true)
+	waitStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	waitStatus("nsm-adapter", healthpb.HealthCheckResponse_NOT_SERVING)
+}
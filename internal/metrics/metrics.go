@@ -0,0 +1,141 @@
+// Package metrics - Is the package for the Prometheus metrics of the adapter
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "meshery_nsm"
+
+	// ResultSucceeded is the result of an operation or apply which succeeded
+	ResultSucceeded = "succeeded"
+	// ResultFailed is the result of an operation or apply which failed
+	ResultFailed = "failed"
+
+	// ApplyHelm is the kind of the applies of helm charts
+	ApplyHelm = "helm"
+	// ApplyManifest is the kind of the applies of manifests
+	ApplyManifest = "manifest"
+
+	// SourceHelm is the source of the fetches of the helm charts
+	SourceHelm = "helm"
+	// SourceGitHub is the source of the fetches of the NSM releases
+	SourceGitHub = "github"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	operations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operations_total",
+		Help:      "Number of operations completed by the adapter, by operation and result.",
+	}, []string{"operation", "result"})
+
+	operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of the operations completed by the adapter, by operation and result.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"operation", "result"})
+
+	operationsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "operations_in_flight",
+		Help:      "Number of operations being run by the adapter, by operation.",
+	}, []string{"operation"})
+
+	applyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cluster_apply_duration_seconds",
+		Help:      "Duration of the applies of helm charts and manifests on each cluster, by cluster, kind and result.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300},
+	}, []string{"cluster", "kind", "result"})
+
+	fetchFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fetch_failures_total",
+		Help:      "Number of failed fetches of helm charts and NSM releases, by source.",
+	}, []string{"source"})
+
+	dataplane = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dataplane_series",
+		Help:      "Last collected value of the metric series of the NSM managers and forwarders, by cluster, pod, component and series.",
+	}, []string{"cluster", "pod", "component", "series"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	register(registry)
+}
+
+// register registers the collectors of the adapter metrics
+func register(r prometheus.Registerer) {
+	r.MustRegister(
+		operations,
+		operationDuration,
+		operationsInFlight,
+		applyDuration,
+		fetchFailures,
+		dataplane,
+	)
+}
+
+// result returns the result label of the error
+func result(err error) string {
+	if err != nil {
+		return ResultFailed
+	}
+	return ResultSucceeded
+}
+
+// OperationStarted records the start of the operation, it must be followed
+// by a call to OperationFinished
+func OperationStarted(operation string) {
+	operationsInFlight.WithLabelValues(operation).Inc()
+}
+
+// OperationFinished records the outcome of the operation started at the time
+func OperationFinished(operation string, started time.Time, err error) {
+	res := result(err)
+	operationsInFlight.WithLabelValues(operation).Dec()
+	operations.WithLabelValues(operation, res).Inc()
+	operationDuration.WithLabelValues(operation, res).Observe(time.Since(started).Seconds())
+}
+
+// ObserveApply records the latency of the apply of the kind started at the
+// time on the cluster
+func ObserveApply(cluster, kind string, started time.Time, err error) {
+	applyDuration.WithLabelValues(cluster, kind, result(err)).Observe(time.Since(started).Seconds())
+}
+
+// FetchFailed records a failed fetch from the source
+func FetchFailed(source string) {
+	fetchFailures.WithLabelValues(source).Inc()
+}
+
+// ResetDataplane removes the collected data plane series of the cluster
+func ResetDataplane(cluster string) {
+	dataplane.DeletePartialMatch(prometheus.Labels{"cluster": cluster})
+}
+
+// SetDataplane sets the collected value of the data plane series of the
+// pod of the cluster
+func SetDataplane(cluster, pod, component, series string, value float64) {
+	dataplane.WithLabelValues(cluster, pod, component, series).Set(value)
+}
+
+// Handler returns the HTTP handler serving the metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gather returns the metric of the family with the labels, nil if the
+// registry has no such metric
+func gather(t *testing.T, r *prometheus.Registry, name string, labels map[string]string) *dto.Metric {
+	t.Helper()
+	families, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			matched := len(m.GetLabel()) == len(labels)
+			for _, l := range m.GetLabel() {
+				matched = matched && labels[l.GetName()] == l.GetValue()
+			}
+			if matched {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+func TestObserveApply(t *testing.T) {
+	r := prometheus.NewRegistry()
+	register(r)
+
+	tests := []struct {
+		name    string
+		cluster string
+		kind    string
+		err     error
+		result  string
+	}{
+		{name: "helm", cluster: "apply-0", kind: ApplyHelm, result: ResultSucceeded},
+		{name: "manifest", cluster: "apply-0", kind: ApplyManifest, result: ResultSucceeded},
+		{name: "failed", cluster: "apply-1", kind: ApplyHelm, err: errors.New("unreachable"), result: ResultFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ObserveApply(tt.cluster, tt.kind, time.Now().Add(-2*time.Second), tt.err)
+
+			m := gather(t, r, "meshery_nsm_cluster_apply_duration_seconds", map[string]string{
+				"cluster": tt.cluster,
+				"kind":    tt.kind,
+				"result":  tt.result,
+			})
+			if m == nil {
+				t.Fatalf("no apply duration recorded for %s %s %s", tt.cluster, tt.kind, tt.result)
+			}
+			h := m.GetHistogram()
+			if h.GetSampleCount() != 1 || h.GetSampleSum() < 2 {
+				t.Errorf("apply duration count = %d, sum = %v, want a single sample of at least 2s", h.GetSampleCount(), h.GetSampleSum())
+			}
+		})
+	}
+}
+
+func TestOperation(t *testing.T) {
+	r := prometheus.NewRegistry()
+	register(r)
+
+	tests := []struct {
+		name      string
+		operation string
+		err       error
+		result    string
+	}{
+		{name: "succeeded", operation: "operation-0", result: ResultSucceeded},
+		{name: "failed", operation: "operation-1", err: errors.New("unreachable"), result: ResultFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inFlight := func() float64 {
+				t.Helper()
+				m := gather(t, r, "meshery_nsm_operations_in_flight", map[string]string{"operation": tt.operation})
+				if m == nil {
+					t.Fatalf("no in-flight gauge recorded for %s", tt.operation)
+				}
+				return m.GetGauge().GetValue()
+			}
+
+			started := time.Now().Add(-time.Second)
+			OperationStarted(tt.operation)
+			if got := inFlight(); got != 1 {
+				t.Errorf("operations in flight after start = %v, want 1", got)
+			}
+			OperationFinished(tt.operation, started, tt.err)
+			if got := inFlight(); got != 0 {
+				t.Errorf("operations in flight after finish = %v, want 0", got)
+			}
+
+			labels := map[string]string{"operation": tt.operation, "result": tt.result}
+			m := gather(t, r, "meshery_nsm_operations_total", labels)
+			if m == nil || m.GetCounter().GetValue() != 1 {
+				t.Errorf("operations total %v = %v, want 1", labels, m.GetCounter().GetValue())
+			}
+			m = gather(t, r, "meshery_nsm_operation_duration_seconds", labels)
+			if h := m.GetHistogram(); h.GetSampleCount() != 1 || h.GetSampleSum() < 1 {
+				t.Errorf("operation duration %v count = %d, sum = %v, want a single sample of at least 1s", labels, h.GetSampleCount(), h.GetSampleSum())
+			}
+			for _, other := range []string{ResultSucceeded, ResultFailed} {
+				if other == tt.result {
+					continue
+				}
+				if m := gather(t, r, "meshery_nsm_operations_total", map[string]string{"operation": tt.operation, "result": other}); m != nil {
+					t.Errorf("operations total recorded result %s, want only %s", other, tt.result)
+				}
+			}
+		})
+	}
+}
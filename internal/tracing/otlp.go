@@ -0,0 +1,199 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/api/global"
+	apitrace "go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	// exportTimeout bounds the time spent sending a batch of spans
+	exportTimeout = 10 * time.Second
+
+	// exportMethod is the RPC of the OTLP trace service receiving the spans.
+	// Its request holds the resource spans in the first field, exactly as the
+	// TracesData message, and its response only reports partial successes,
+	// which lets the exporter call it without the generated collector
+	// package and the grpc-gateway dependency coming with it
+	exportMethod = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+)
+
+// otlpExporter sends the spans of the OpenTelemetry SDK used by
+// meshery-adapter-library to an OTLP gRPC collector, such as the Jaeger
+// deployed by the NSM addons
+type otlpExporter struct {
+	conn *grpc.ClientConn
+}
+
+var _ export.SpanBatcher = (*otlpExporter)(nil)
+
+// newOTLPExporter connects to the OTLP gRPC collector at the endpoint, the
+// scheme of the endpoint, if any, is ignored. The connection is established
+// in the background so that an unavailable collector does not prevent the
+// adapter from starting
+func newOTLPExporter(endpoint string) (*otlpExporter, error) {
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		endpoint = endpoint[i+3:]
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	conn, err := grpc.Dial(endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &otlpExporter{conn: conn}, nil
+}
+
+// ExportSpans implements the span batcher of the OpenTelemetry SDK, the
+// failures are reported to the global error handler since the SDK does not
+// expect any
+func (e *otlpExporter) ExportSpans(ctx context.Context, sds []*export.SpanData) {
+	if len(sds) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+	req := &tracepb.TracesData{ResourceSpans: resourceSpans(sds)}
+	if err := e.conn.Invoke(ctx, exportMethod, req, &emptypb.Empty{}); err != nil {
+		global.Handle(err)
+	}
+}
+
+// Shutdown closes the connection to the collector
+func (e *otlpExporter) Shutdown() error {
+	return e.conn.Close()
+}
+
+// resourceSpans groups the spans by resource and instrumentation library
+func resourceSpans(sds []*export.SpanData) []*tracepb.ResourceSpans {
+	var rss []*tracepb.ResourceSpans
+	byResource := make(map[label.Distinct]*tracepb.ResourceSpans)
+	byScope := make(map[label.Distinct]map[instrumentation.Library]*tracepb.ScopeSpans)
+	for _, sd := range sds {
+		key := sd.Resource.Equivalent()
+		rs, ok := byResource[key]
+		if !ok {
+			rs = &tracepb.ResourceSpans{Resource: resourceProto(sd.Resource)}
+			byResource[key] = rs
+			byScope[key] = make(map[instrumentation.Library]*tracepb.ScopeSpans)
+			rss = append(rss, rs)
+		}
+		ss, ok := byScope[key][sd.InstrumentationLibrary]
+		if !ok {
+			ss = &tracepb.ScopeSpans{
+				Scope: &commonpb.InstrumentationScope{
+					Name:    sd.InstrumentationLibrary.Name,
+					Version: sd.InstrumentationLibrary.Version,
+				},
+			}
+			byScope[key][sd.InstrumentationLibrary] = ss
+			rs.ScopeSpans = append(rs.ScopeSpans, ss)
+		}
+		ss.Spans = append(ss.Spans, spanProto(sd))
+	}
+	return rss
+}
+
+func resourceProto(res *resource.Resource) *resourcepb.Resource {
+	if res == nil {
+		return nil
+	}
+	return &resourcepb.Resource{Attributes: attributesProto(res.Attributes())}
+}
+
+func spanProto(sd *export.SpanData) *tracepb.Span {
+	traceID := sd.SpanContext.TraceID
+	spanID := sd.SpanContext.SpanID
+	span := &tracepb.Span{
+		TraceId:                traceID[:],
+		SpanId:                 spanID[:],
+		Name:                   sd.Name,
+		Kind:                   tracepb.Span_SpanKind(apitrace.ValidateSpanKind(sd.SpanKind)),
+		StartTimeUnixNano:      uint64(sd.StartTime.UnixNano()),
+		EndTimeUnixNano:        uint64(sd.EndTime.UnixNano()),
+		Attributes:             attributesProto(sd.Attributes),
+		DroppedAttributesCount: uint32(sd.DroppedAttributeCount),
+		DroppedEventsCount:     uint32(sd.DroppedMessageEventCount),
+		DroppedLinksCount:      uint32(sd.DroppedLinkCount),
+		Status:                 statusProto(sd.StatusCode, sd.StatusMessage),
+	}
+	if sd.ParentSpanID.IsValid() {
+		parentID := sd.ParentSpanID
+		span.ParentSpanId = parentID[:]
+	}
+	for _, event := range sd.MessageEvents {
+		span.Events = append(span.Events, &tracepb.Span_Event{
+			Name:         event.Name,
+			TimeUnixNano: uint64(event.Time.UnixNano()),
+			Attributes:   attributesProto(event.Attributes),
+		})
+	}
+	for _, link := range sd.Links {
+		linkTraceID := link.TraceID
+		linkSpanID := link.SpanID
+		span.Links = append(span.Links, &tracepb.Span_Link{
+			TraceId:    linkTraceID[:],
+			SpanId:     linkSpanID[:],
+			Attributes: attributesProto(link.Attributes),
+		})
+	}
+	return span
+}
+
+// statusProto maps the gRPC like status codes of the SDK to the OTLP ones
+func statusProto(code codes.Code, message string) *tracepb.Status {
+	if code == codes.OK {
+		return &tracepb.Status{Code: tracepb.Status_STATUS_CODE_UNSET}
+	}
+	return &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: message}
+}
+
+func attributesProto(kvs []label.KeyValue) []*commonpb.KeyValue {
+	if len(kvs) == 0 {
+		return nil
+	}
+	attrs := make([]*commonpb.KeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		attrs = append(attrs, &commonpb.KeyValue{
+			Key:   string(kv.Key),
+			Value: valueProto(kv.Value),
+		})
+	}
+	return attrs
+}
+
+func valueProto(v label.Value) *commonpb.AnyValue {
+	switch v.Type() {
+	case label.BOOL:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.AsBool()}}
+	case label.INT32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v.AsInt32())}}
+	case label.INT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.AsInt64()}}
+	case label.UINT32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v.AsUint32())}}
+	case label.UINT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v.AsUint64())}}
+	case label.FLOAT32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: float64(v.AsFloat32())}}
+	case label.FLOAT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.AsFloat64()}}
+	case label.STRING:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.AsString()}}
+	default:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Emit()}}
+	}
+}
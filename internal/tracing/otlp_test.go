@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/label"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// collector is an OTLP trace collector keeping the received spans
+type collector struct {
+	mu      sync.Mutex
+	methods []string
+	spans   []*tracepb.Span
+	service string
+}
+
+func (c *collector) handle(_ interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	req := &tracepb.TracesData{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.methods = append(c.methods, method)
+	for _, rs := range req.ResourceSpans {
+		for _, attr := range rs.GetResource().GetAttributes() {
+			if attr.Key == "service.name" {
+				c.service = attr.GetValue().GetStringValue()
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	c.mu.Unlock()
+	return stream.SendMsg(&emptypb.Empty{})
+}
+
+func TestInit(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &collector{}
+	server := grpc.NewServer(grpc.UnknownServiceHandler(c.handle))
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	flush, err := Init("meshery-nsm", "http://"+lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, parent := Start(context.Background(), "ApplyOperation", label.String("operation", "test"))
+	childCtx, child := Start(ctx, "cluster", label.Int("objects", 2))
+	End(childCtx, child, errors.New("unreachable"))
+	End(ctx, parent, nil)
+	flush()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.methods) != 1 || c.methods[0] != exportMethod {
+		t.Fatalf("collector received %v, want a single %s call", c.methods, exportMethod)
+	}
+	if c.service != "meshery-nsm" {
+		t.Errorf("service name = %q, want meshery-nsm", c.service)
+	}
+	if len(c.spans) != 2 {
+		t.Fatalf("collector received %d spans, want 2", len(c.spans))
+	}
+	byName := make(map[string]*tracepb.Span)
+	for _, span := range c.spans {
+		byName[span.Name] = span
+	}
+	root, cluster := byName["ApplyOperation"], byName["cluster"]
+	if root == nil || cluster == nil {
+		t.Fatalf("collector received spans %v, want ApplyOperation and cluster", byName)
+	}
+	if len(root.ParentSpanId) != 0 {
+		t.Errorf("ApplyOperation has parent %x, want none", root.ParentSpanId)
+	}
+	if !bytes.Equal(cluster.ParentSpanId, root.SpanId) || !bytes.Equal(cluster.TraceId, root.TraceId) {
+		t.Errorf("cluster span is not a child of the ApplyOperation span")
+	}
+	if got := root.GetStatus().GetCode(); got != tracepb.Status_STATUS_CODE_UNSET {
+		t.Errorf("ApplyOperation status = %v, want unset", got)
+	}
+	if got := cluster.GetStatus(); got.GetCode() != tracepb.Status_STATUS_CODE_ERROR || got.GetMessage() != "unreachable" {
+		t.Errorf("cluster status = %v, want error unreachable", got)
+	}
+	wantAttr := &commonpb.KeyValue{Key: "objects", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 2}}}
+	if len(cluster.Attributes) != 1 || !proto.Equal(cluster.Attributes[0], wantAttr) {
+		t.Errorf("cluster attributes = %v, want [%v]", cluster.Attributes, wantAttr)
+	}
+}
@@ -0,0 +1,102 @@
+// Package tracing - Is the package for the OpenTelemetry traces of the adapter
+package tracing
+
+import (
+	"context"
+
+	adaptertracing "github.com/layer5io/meshery-adapter-library/api/tracing"
+	"go.opentelemetry.io/otel/api/global"
+	apitrace "go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+// instrumentationName is the name of the tracer of the adapter spans
+const instrumentationName = "github.com/layer5io/meshery-nsm"
+
+// Init exports the traces of the adapter to the OTLP gRPC collector at the
+// endpoint, e.g. the Jaeger deployed by the NSM addons on port 4317, and
+// returns the function flushing the pending spans. The traces are dropped
+// when no endpoint is configured.
+//
+// The spans are recorded with the OpenTelemetry release used by the gRPC
+// server of meshery-adapter-library, which predates the OTLP exporters, so
+// they are sent by the exporter of this package
+func Init(service, endpoint string) (func(), error) {
+	if endpoint == "" {
+		return func() {}, nil
+	}
+	exporter, err := newOTLPExporter(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	processor, err := sdktrace.NewBatchSpanProcessor(exporter)
+	if err != nil {
+		_ = exporter.Shutdown()
+		return nil, err
+	}
+	provider, err := sdktrace.NewProvider(
+		sdktrace.WithConfig(sdktrace.Config{DefaultSampler: sdktrace.AlwaysSample()}),
+		sdktrace.WithResource(resource.New(semconv.ServiceNameKey.String(service))),
+	)
+	if err != nil {
+		_ = exporter.Shutdown()
+		return nil, err
+	}
+	provider.RegisterSpanProcessor(processor)
+	global.SetTraceProvider(provider)
+	return func() {
+		provider.UnregisterSpanProcessor(processor)
+		_ = exporter.Shutdown()
+	}, nil
+}
+
+// Start starts a span as a child of the span of the context, if any
+func Start(ctx context.Context, name string, attrs ...label.KeyValue) (context.Context, apitrace.Span) {
+	return global.Tracer(instrumentationName).Start(ctx, name, apitrace.WithAttributes(attrs...))
+}
+
+// End records the error, if any, on the span and ends it
+func End(ctx context.Context, span apitrace.Span, err error) {
+	if err != nil {
+		span.RecordError(ctx, err)
+		span.SetStatus(codes.Internal, err.Error())
+	}
+	span.End()
+}
+
+// Handler returns the handler tracing the gRPC requests served by the
+// adapter with the tracer of the adapter spans
+func Handler() adaptertracing.Handler {
+	return &handler{}
+}
+
+// handler implements the tracing handler of meshery-adapter-library on
+// top of the global trace provider
+type handler struct {
+	ctx  context.Context
+	span apitrace.Span
+}
+
+func (h *handler) Tracer(name string) interface{} {
+	return global.Tracer(name)
+}
+
+func (h *handler) Span(ctx context.Context) {
+	h.ctx = ctx
+	h.span = apitrace.SpanFromContext(ctx)
+}
+
+func (h *handler) AddEvent(name string, attrs ...*adaptertracing.KeyValue) {
+	if h.span == nil {
+		return
+	}
+	kvs := make([]label.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		kvs = append(kvs, label.String(attr.Key, attr.Value))
+	}
+	h.span.AddEvent(h.ctx, name, kvs...)
+}
@@ -15,7 +15,11 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/http"
 	"os"
 	"path"
 	"strings"
@@ -25,11 +29,29 @@ import (
 	"github.com/layer5io/meshkit/logger"
 	"github.com/layer5io/meshkit/utils/events"
 
-	// "github.com/layer5io/meshkit/tracing"
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-adapter-library/api/grpc"
+	adaptertracing "github.com/layer5io/meshery-adapter-library/api/tracing"
+	adapterconfig "github.com/layer5io/meshery-adapter-library/config"
 	configprovider "github.com/layer5io/meshery-adapter-library/config/provider"
+	"github.com/layer5io/meshery-adapter-library/status"
 	"github.com/layer5io/meshery-nsm/internal/config"
+	"github.com/layer5io/meshery-nsm/internal/health"
+	"github.com/layer5io/meshery-nsm/internal/metrics"
+	"github.com/layer5io/meshery-nsm/internal/tracing"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// readinessInterval is the interval at which the serving status of the
+	// gRPC health checking protocol is updated
+	readinessInterval = 10 * time.Second
+
+	// defaultHealthGRPCAddr is the address the gRPC health checking protocol
+	// is served at when HEALTH_GRPC_ADDR is not set. The gRPC server of the
+	// adapter is started by meshery-adapter-library, which does not let the
+	// health service be registered on the adapter port
+	defaultHealthGRPCAddr = ":10104"
 )
 
 var (
@@ -90,16 +112,84 @@ func main() {
 		os.Exit(1)
 	}
 
-	// // Initialize Tracing instance
-	// tracer, err := tracing.New(service.Name, service.TraceURL)
-	// if err != nil {
-	//      log.Err("Tracing Init Failed", err.Error())
-	//      os.Exit(1)
-	// }
+	// Initialize Tracing instance
+	traceURL := service.TraceURL
+	if traceURL == status.None {
+		traceURL = ""
+	}
+	flush, err := tracing.Init(service.Name, traceURL)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
 
 	// Initialize Handler intance
 	e := events.NewEventStreamer()
 	handler := nsm.New(cfg, log, kubeconfigHandler, e)
+
+	// Rewrite the image references for air-gapped environments
+	imageOpts, err := imageRewriteOptions()
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	handler.(*nsm.Mesh).RewriteImages(imageOpts)
+
+	// Keep the kubeconfigs of the installed clusters across restarts only
+	// when explicitly enabled, they are credentials stored in plaintext
+	handler.(*nsm.Mesh).JournalKubeconfigs(strings.ToLower(os.Getenv("JOURNAL_KUBECONFIGS")) == "true")
+
+	// Start the drift reconciler when an interval is configured
+	if opts, ok, err := reconcileOptions(); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	} else if ok {
+		go func() {
+			if err := handler.(*nsm.Mesh).Reconcile(context.Background(), opts); err != nil {
+				log.Error(err)
+			}
+		}()
+	}
+
+	checker := readinessChecker(cfg)
+
+	// Serve the metrics and the HTTP health endpoints when their addresses
+	// are configured, endpoints configured at the same address share a server
+	muxes := make(map[string]*http.ServeMux)
+	muxFor := func(addr string) *http.ServeMux {
+		if _, ok := muxes[addr]; !ok {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		muxFor(addr).Handle("/metrics", metrics.Handler())
+	}
+	if addr := os.Getenv("HEALTH_ADDR"); addr != "" {
+		checker.Register(muxFor(addr))
+	}
+	for addr, mux := range muxes {
+		go func(addr string, mux *http.ServeMux) {
+			log.Info("HTTP endpoints listening at address: ", addr)
+			srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+			if err := srv.ListenAndServe(); err != nil {
+				log.Error(err)
+			}
+		}(addr, mux)
+	}
+
+	// The gRPC health checking protocol is always served
+	healthGRPCAddr := os.Getenv("HEALTH_GRPC_ADDR")
+	if healthGRPCAddr == "" {
+		healthGRPCAddr = defaultHealthGRPCAddr
+	}
+	go func() {
+		log.Info("gRPC health checking listening at address: ", healthGRPCAddr)
+		if err := checker.ServeGRPC(context.Background(), healthGRPCAddr, service.Name, readinessInterval); err != nil {
+			log.Error(err)
+		}
+	}()
+
 	handler = adapter.AddLogger(log, handler)
 	service.EventStreamer = e
 	service.Handler = handler
@@ -109,7 +199,12 @@ func main() {
 
 	// Server Initialization
 	log.Info("Adaptor Listening at port: ", service.Port)
-	err = grpc.Start(service, nil)
+	var tracer adaptertracing.Handler
+	if traceURL != "" {
+		tracer = tracing.Handler()
+	}
+	err = grpc.Start(service, tracer)
+	flush()
 	if err != nil {
 		log.Error(err)
 		os.Exit(1)
@@ -120,3 +215,89 @@ func main() {
 func isDebugLog() bool {
 	return strings.ToLower(os.Getenv("DEBUG")) == "true"
 }
+
+// reconcileOptions returns the options of the drift reconciler from the
+// RECONCILE_INTERVAL, RECONCILE_MODE and RECONCILE_IGNORE env vars, the
+// reconciler is disabled when RECONCILE_INTERVAL is not set
+func reconcileOptions() (nsm.ReconcileOptions, bool, error) {
+	opts := nsm.ReconcileOptions{Mode: nsm.ReconcileReport}
+	interval := os.Getenv("RECONCILE_INTERVAL")
+	if interval == "" {
+		return opts, false, nil
+	}
+
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return opts, false, err
+	}
+	opts.Interval = d
+	if mode := os.Getenv("RECONCILE_MODE"); mode != "" {
+		opts.Mode = strings.ToLower(mode)
+	}
+	if ignore := os.Getenv("RECONCILE_IGNORE"); ignore != "" {
+		opts.Ignore = strings.Split(ignore, ",")
+	}
+	return opts, true, nil
+}
+
+// imageRewriteOptions returns the options of the image rewriting from the
+// REGISTRY_MIRRORS and PIN_IMAGE_DIGESTS env vars. The mirrors are a comma
+// separated list of source=mirror pairs, e.g.
+// "ghcr.io/networkservicemesh=registry.local/nsm,docker.io=registry.local"
+func imageRewriteOptions() (nsm.ImageRewriteOptions, error) {
+	opts := nsm.ImageRewriteOptions{
+		Mirrors:    map[string]string{},
+		PinDigests: strings.ToLower(os.Getenv("PIN_IMAGE_DIGESTS")) == "true",
+	}
+	mirrors := os.Getenv("REGISTRY_MIRRORS")
+	if mirrors == "" {
+		return opts, nil
+	}
+	for _, pair := range strings.Split(mirrors, ",") {
+		src, dst, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || src == "" || dst == "" {
+			return opts, fmt.Errorf("invalid registry mirror %q, expected source=mirror", pair)
+		}
+		opts.Mirrors[src] = dst
+	}
+	return opts, nil
+}
+
+// readinessChecker returns the checker of the readiness of the adapter,
+// which requires its config to be loaded, the catalog of the NSM releases
+// to be available and the kubeconfig, if any, to be valid
+func readinessChecker(cfg adapterconfig.Handler) *health.Checker {
+	checker := health.NewChecker()
+	checker.Add("config", func() error {
+		return cfg.GetObject(adapter.ServerKey, &grpc.Service{})
+	})
+	checker.Add("releases", func() error {
+		operations := make(adapter.Operations)
+		if err := cfg.GetObject(adapter.OperationsKey, &operations); err != nil {
+			return err
+		}
+		op, ok := operations[config.NSMMeshOperation]
+		if !ok || len(op.Versions) == 0 || op.Versions[0] == "" {
+			return fmt.Errorf("no NSM release is available")
+		}
+		return nil
+	})
+	checker.Add("kubeconfig", func() error {
+		// The kubeconfigs are passed along with the operations until
+		// Meshery persists one
+		kubeconfig := os.Getenv("KUBECONFIG")
+		if _, err := os.Stat(kubeconfig); errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		kc, err := clientcmd.LoadFromFile(kubeconfig)
+		if err != nil {
+			return err
+		}
+		if len(kc.Contexts) == 0 {
+			return nil
+		}
+		_, err = clientcmd.NewDefaultClientConfig(*kc, &clientcmd.ConfigOverrides{}).ClientConfig()
+		return err
+	})
+	return checker
+}
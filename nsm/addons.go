@@ -0,0 +1,563 @@
+package nsm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// jaegerImageTag is the tag of the Jaeger all-in-one image
+	jaegerImageTag = "1.47"
+	// prometheusImageTag is the tag of the Prometheus image
+	prometheusImageTag = "v2.45.0"
+	// grafanaImageTag is the tag of the Grafana image
+	grafanaImageTag = "9.5.3"
+)
+
+// telemetryComponents are the name prefixes of the NSM workloads whose
+// telemetry is configured by the add-ons
+var telemetryComponents = []string{"nsmgr", "forwarder", "registry"}
+
+// addon describes an observability add-on deployed next to NSM
+type addon struct {
+	// Name is the name of the add-on
+	Name string
+	// Template is the manifest of the add-on
+	Template *template.Template
+	// Env returns the environment of the NSM components which enables
+	// their telemetry for the add-on, if any
+	Env func(addonValues) map[string]string
+	// Annotations returns the annotations of the pods of the NSM
+	// components used by the add-on, if any
+	Annotations func(addonValues) map[string]string
+}
+
+// addonValues holds the values of the add-on templates
+type addonValues struct {
+	// Namespace is the namespace of the NSM install
+	Namespace string
+	// MetricsPort is the port the NSM components serve their metrics on
+	MetricsPort string
+	// Tag is the tag of the image of the add-on
+	Tag string
+}
+
+// addons maps the add-on names to the add-ons
+var addons = map[string]addon{
+	"jaeger": {
+		Name:     "jaeger",
+		Template: jaegerTemplate,
+		Env: func(v addonValues) map[string]string {
+			return map[string]string{
+				"TELEMETRY":                   "true",
+				"NSM_OPEN_TELEMETRY_ENDPOINT": fmt.Sprintf("jaeger.%s.svc:4317", v.Namespace),
+			}
+		},
+	},
+	"prometheus": {
+		Name:     "prometheus",
+		Template: prometheusTemplate,
+		Env: func(v addonValues) map[string]string {
+			return map[string]string{
+				"NSM_PROMETHEUS":           "true",
+				"NSM_PROMETHEUS_LISTEN_ON": ":" + v.MetricsPort,
+			}
+		},
+		Annotations: func(v addonValues) map[string]string {
+			return map[string]string{
+				"prometheus.io/scrape":   "true",
+				prometheusPortAnnotation: v.MetricsPort,
+			}
+		},
+	},
+	"grafana": {
+		Name:     "grafana",
+		Template: grafanaTemplate,
+	},
+}
+
+// addonImageTags maps the add-on names to the tags of their images
+var addonImageTags = map[string]string{
+	"jaeger":     jaegerImageTag,
+	"prometheus": prometheusImageTag,
+	"grafana":    grafanaImageTag,
+}
+
+// jaegerTemplate is the manifest of the Jaeger all-in-one deployment
+// collecting the OTLP traces of the NSM components
+var jaegerTemplate = template.Must(template.New("jaeger").Parse(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: jaeger
+  namespace: {{ .Namespace }}
+  labels:
+    app: jaeger
+spec:
+  selector:
+    matchLabels:
+      app: jaeger
+  template:
+    metadata:
+      labels:
+        app: jaeger
+    spec:
+      containers:
+        - name: jaeger
+          image: jaegertracing/all-in-one:{{ .Tag }}
+          imagePullPolicy: IfNotPresent
+          env:
+            - name: COLLECTOR_OTLP_ENABLED
+              value: "true"
+          ports:
+            - name: ui
+              containerPort: 16686
+            - name: otlp-grpc
+              containerPort: 4317
+            - name: otlp-http
+              containerPort: 4318
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: jaeger
+  namespace: {{ .Namespace }}
+spec:
+  selector:
+    app: jaeger
+  ports:
+    - name: ui
+      port: 16686
+    - name: otlp-grpc
+      port: 4317
+    - name: otlp-http
+      port: 4318
+`))
+
+// prometheusTemplate is the manifest of the Prometheus deployment scraping
+// the pods of the NSM namespace which enable it with their annotations
+var prometheusTemplate = template.Must(template.New("prometheus").Parse(`---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: prometheus
+  namespace: {{ .Namespace }}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: prometheus
+  namespace: {{ .Namespace }}
+rules:
+  - apiGroups: [""]
+    resources: ["pods"]
+    verbs: ["get", "list", "watch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: prometheus
+  namespace: {{ .Namespace }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: prometheus
+subjects:
+  - kind: ServiceAccount
+    name: prometheus
+    namespace: {{ .Namespace }}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: prometheus-config
+  namespace: {{ .Namespace }}
+data:
+  prometheus.yml: |
+    global:
+      scrape_interval: 15s
+    scrape_configs:
+      - job_name: nsm
+        kubernetes_sd_configs:
+          - role: pod
+            namespaces:
+              names: [{{ .Namespace }}]
+        relabel_configs:
+          - source_labels: [__meta_kubernetes_pod_annotation_prometheus_io_scrape]
+            action: keep
+            regex: "true"
+          - source_labels: [__address__, __meta_kubernetes_pod_annotation_prometheus_io_port]
+            action: replace
+            regex: ([^:]+)(?::\d+)?;(\d+)
+            replacement: $1:$2
+            target_label: __address__
+          - source_labels: [__meta_kubernetes_pod_name]
+            target_label: pod
+          - source_labels: [__meta_kubernetes_pod_node_name]
+            target_label: node
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: prometheus
+  namespace: {{ .Namespace }}
+  labels:
+    app: prometheus
+spec:
+  selector:
+    matchLabels:
+      app: prometheus
+  template:
+    metadata:
+      labels:
+        app: prometheus
+    spec:
+      serviceAccountName: prometheus
+      containers:
+        - name: prometheus
+          image: prom/prometheus:{{ .Tag }}
+          imagePullPolicy: IfNotPresent
+          args: ["--config.file=/etc/prometheus/prometheus.yml"]
+          ports:
+            - name: web
+              containerPort: 9090
+          volumeMounts:
+            - name: config
+              mountPath: /etc/prometheus
+              readOnly: true
+      volumes:
+        - name: config
+          configMap:
+            name: prometheus-config
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: prometheus
+  namespace: {{ .Namespace }}
+spec:
+  selector:
+    app: prometheus
+  ports:
+    - name: web
+      port: 9090
+`))
+
+// grafanaTemplate is the manifest of the Grafana deployment provisioned
+// with the Prometheus and Jaeger add-ons as data sources and with the
+// dashboard of the NSM data plane
+var grafanaTemplate = template.Must(template.New("grafana").Parse(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: grafana-provisioning
+  namespace: {{ .Namespace }}
+data:
+  datasources.yaml: |
+    apiVersion: 1
+    datasources:
+      - name: Prometheus
+        type: prometheus
+        access: proxy
+        url: http://prometheus.{{ .Namespace }}.svc:9090
+        isDefault: true
+      - name: Jaeger
+        type: jaeger
+        access: proxy
+        url: http://jaeger.{{ .Namespace }}.svc:16686
+  dashboards.yaml: |
+    apiVersion: 1
+    providers:
+      - name: nsm
+        folder: NSM
+        type: file
+        options:
+          path: /var/lib/grafana/dashboards
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: grafana-dashboards
+  namespace: {{ .Namespace }}
+data:
+  nsm.json: |
+    {
+      "title": "NSM Data Plane",
+      "uid": "nsm-data-plane",
+      "schemaVersion": 36,
+      "refresh": "30s",
+      "time": {"from": "now-1h", "to": "now"},
+      "panels": [
+        {
+          "title": "Connections",
+          "type": "timeseries",
+          "gridPos": {"x": 0, "y": 0, "w": 12, "h": 8},
+          "targets": [{"expr": "sum by (pod) ({__name__=~\".*connection.*\"})", "legendFormat": "{{"{{pod}}"}}"}]
+        },
+        {
+          "title": "Heal Events",
+          "type": "timeseries",
+          "gridPos": {"x": 12, "y": 0, "w": 12, "h": 8},
+          "targets": [{"expr": "sum by (pod) (rate({__name__=~\".*heal.*\"}[5m]))", "legendFormat": "{{"{{pod}}"}}"}]
+        },
+        {
+          "title": "Forwarder Received Bytes",
+          "type": "timeseries",
+          "gridPos": {"x": 0, "y": 8, "w": 12, "h": 8},
+          "targets": [{"expr": "sum by (pod) (rate({__name__=~\".*_rx_bytes.*\", pod=~\"forwarder.*\"}[5m]))", "legendFormat": "{{"{{pod}}"}}"}]
+        },
+        {
+          "title": "Forwarder Transmitted Bytes",
+          "type": "timeseries",
+          "gridPos": {"x": 12, "y": 8, "w": 12, "h": 8},
+          "targets": [{"expr": "sum by (pod) (rate({__name__=~\".*_tx_bytes.*\", pod=~\"forwarder.*\"}[5m]))", "legendFormat": "{{"{{pod}}"}}"}]
+        }
+      ]
+    }
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: grafana
+  namespace: {{ .Namespace }}
+  labels:
+    app: grafana
+spec:
+  selector:
+    matchLabels:
+      app: grafana
+  template:
+    metadata:
+      labels:
+        app: grafana
+    spec:
+      containers:
+        - name: grafana
+          image: grafana/grafana:{{ .Tag }}
+          imagePullPolicy: IfNotPresent
+          ports:
+            - name: web
+              containerPort: 3000
+          volumeMounts:
+            - name: provisioning
+              mountPath: /etc/grafana/provisioning/datasources/datasources.yaml
+              subPath: datasources.yaml
+              readOnly: true
+            - name: provisioning
+              mountPath: /etc/grafana/provisioning/dashboards/dashboards.yaml
+              subPath: dashboards.yaml
+              readOnly: true
+            - name: dashboards
+              mountPath: /var/lib/grafana/dashboards
+              readOnly: true
+      volumes:
+        - name: provisioning
+          configMap:
+            name: grafana-provisioning
+        - name: dashboards
+          configMap:
+            name: grafana-dashboards
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: grafana
+  namespace: {{ .Namespace }}
+spec:
+  selector:
+    app: grafana
+  ports:
+    - name: web
+      port: 3000
+`))
+
+// getAddon returns the named add-on
+func getAddon(name string) (addon, error) {
+	a, ok := addons[name]
+	if !ok {
+		return addon{}, ErrAddon(fmt.Errorf("unsupported add-on: %s", name))
+	}
+	return a, nil
+}
+
+// installAddon deploys or removes the add-on in the namespace of the NSM
+// install and enables or disables the telemetry of the NSM components it
+// relies on
+func (mesh *Mesh) installAddon(ctx context.Context, del bool, namespace, metricsPort string, a addon, kubeconfigs []string) (string, error) {
+	st := status.Installing
+	if del {
+		st = status.Removing
+	}
+
+	values := addonValues{Namespace: namespace, MetricsPort: metricsPort, Tag: addonImageTags[a.Name]}
+	var manifest bytes.Buffer
+	if err := a.Template.Execute(&manifest, values); err != nil {
+		return st, ErrAddon(err)
+	}
+	if err := mesh.applyManifest(ctx, manifest.Bytes(), del, namespace, kubeconfigs); err != nil {
+		return st, ErrAddon(err)
+	}
+
+	if a.Env != nil || a.Annotations != nil {
+		if err := mesh.configureTelemetry(ctx, del, namespace, a, values, kubeconfigs); err != nil {
+			return st, ErrAddon(err)
+		}
+	}
+
+	if del {
+		return status.Removed, nil
+	}
+	return status.Installed, nil
+}
+
+// configureTelemetry sets the environment and the pod annotations of the
+// add-on on the NSM workloads of each of the clusters. The fields are
+// applied with a field manager of their own for each add-on, so that
+// removing the add-on removes its fields only and leaves the rest of the
+// workloads, including the fields of the other add-ons, untouched
+func (mesh *Mesh) configureTelemetry(ctx context.Context, del bool, namespace string, a addon, values addonValues, kubeconfigs []string) error {
+	cfg := manifestApplyFrom(ctx)
+	cfg.FieldManager = fmt.Sprintf("%s-%s", fieldManager, a.Name)
+	ctx = withManifestApply(ctx, cfg)
+
+	var errs []error
+	for i, config := range kubeconfigs {
+		cluster := clusterName(i)
+		kClient, err := mesherykube.New([]byte(config))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", cluster, err))
+			continue
+		}
+		patch, err := telemetryPatch(ctx, kClient, del, namespace, a, values)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", cluster, err))
+			continue
+		}
+		if len(patch) == 0 {
+			continue
+		}
+		// The patches are applied rather than deleted on removal, as
+		// applying the bare workloads gives up the fields of the add-on
+		if err := mesh.applyManifestToCluster(ctx, cluster, config, patch, false, namespace); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 0 {
+		return mergeErrors(errs)
+	}
+	return nil
+}
+
+// telemetryPatch returns the server-side apply patches of the NSM
+// workloads of the namespace, setting the environment of their containers
+// and the annotations of their pods. The patches of removed add-ons only
+// identify the workloads
+func telemetryPatch(ctx context.Context, kClient *mesherykube.Client, del bool, namespace string, a addon, values addonValues) ([]byte, error) {
+	type workload struct {
+		kind       string
+		name       string
+		containers []string
+	}
+	var workloads []workload
+
+	deployments, err := kClient.KubeClient.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deployments.Items {
+		var containers []string
+		for _, c := range d.Spec.Template.Spec.Containers {
+			containers = append(containers, c.Name)
+		}
+		workloads = append(workloads, workload{kind: "Deployment", name: d.Name, containers: containers})
+	}
+	daemonsets, err := kClient.KubeClient.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range daemonsets.Items {
+		var containers []string
+		for _, c := range d.Spec.Template.Spec.Containers {
+			containers = append(containers, c.Name)
+		}
+		workloads = append(workloads, workload{kind: "DaemonSet", name: d.Name, containers: containers})
+	}
+
+	var env []interface{}
+	if a.Env != nil {
+		vars := a.Env(values)
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			env = append(env, map[string]interface{}{"name": name, "value": vars[name]})
+		}
+	}
+	var annotations map[string]interface{}
+	if a.Annotations != nil {
+		annotations = make(map[string]interface{})
+		for k, v := range a.Annotations(values) {
+			annotations[k] = v
+		}
+	}
+
+	var patch bytes.Buffer
+	for _, w := range workloads {
+		if !isTelemetryComponent(w.name) {
+			continue
+		}
+		obj := map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       w.kind,
+			"metadata": map[string]interface{}{
+				"name":      w.name,
+				"namespace": namespace,
+			},
+		}
+		if !del {
+			podSpec := map[string]interface{}{}
+			if len(env) != 0 {
+				var containers []interface{}
+				for _, c := range w.containers {
+					containers = append(containers, map[string]interface{}{"name": c, "env": env})
+				}
+				podSpec["containers"] = containers
+			}
+			template := map[string]interface{}{"spec": podSpec}
+			if len(annotations) != 0 {
+				template["metadata"] = map[string]interface{}{"annotations": annotations}
+			}
+			obj["spec"] = map[string]interface{}{"template": template}
+		}
+
+		out, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		patch.WriteString("---\n")
+		patch.Write(out)
+	}
+	return patch.Bytes(), nil
+}
+
+// isTelemetryComponent returns true if the workload is an NSM component
+// whose telemetry is configured by the add-ons
+func isTelemetryComponent(name string) bool {
+	for _, c := range telemetryComponents {
+		if strings.HasPrefix(name, c) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,490 @@
+package nsm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-nsm/internal/tracing"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"go.opentelemetry.io/otel/label"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+// ignoredFields are the fields which are managed by the API server and
+// hence never considered when comparing objects
+var ignoredFields = []string{
+	"metadata.creationTimestamp",
+	"metadata.generation",
+	"metadata.managedFields",
+	"metadata.resourceVersion",
+	"metadata.uid",
+	"status",
+}
+
+// decodeManifest decodes the multi-document YAML or JSON manifest into
+// objects, empty documents are skipped
+func decodeManifest(contents []byte) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(contents), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		err := decoder.Decode(&obj.Object)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, ErrDecodeYaml(err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// newRESTMapper returns a REST mapper backed by the discovery of the cluster
+func newRESTMapper(kClient *mesherykube.Client) meta.RESTMapper {
+	return restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kClient.KubeClient.Discovery()))
+}
+
+// resourceFor returns the dynamic client of the resource of the object. The
+// namespace of namespaced objects is set to the requested namespace, falling
+// back to the one in the manifest and to "default"
+func resourceFor(kClient *mesherykube.Client, mapper meta.RESTMapper, obj *unstructured.Unstructured, namespace string) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return kClient.DynamicKubeClient.Resource(mapping.Resource), nil
+	}
+
+	if namespace == "" {
+		namespace = obj.GetNamespace()
+	}
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	obj.SetNamespace(namespace)
+	return kClient.DynamicKubeClient.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+// objectRef returns the kind, namespace and name of the object for reports
+func objectRef(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return strings.Join([]string{obj.GetKind(), obj.GetName()}, "/")
+	}
+	return strings.Join([]string{obj.GetKind(), obj.GetNamespace(), obj.GetName()}, "/")
+}
+
+// diffObjects returns the sorted paths of the fields which differ between
+// the live and the desired object, ignoring the fields managed by the API server
+func diffObjects(live, desired map[string]interface{}) []string {
+	var paths []string
+	diffFields("", live, desired, &paths)
+	sort.Strings(paths)
+	return paths
+}
+
+func diffFields(prefix string, live, desired map[string]interface{}, paths *[]string) {
+	keys := make(map[string]struct{})
+	for k := range live {
+		keys[k] = struct{}{}
+	}
+	for k := range desired {
+		keys[k] = struct{}{}
+	}
+
+	for k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if isIgnoredField(path) {
+			continue
+		}
+
+		l, lok := live[k].(map[string]interface{})
+		d, dok := desired[k].(map[string]interface{})
+		if lok && dok {
+			diffFields(path, l, d, paths)
+			continue
+		}
+		if !reflect.DeepEqual(live[k], desired[k]) {
+			*paths = append(*paths, path)
+		}
+	}
+}
+
+// diffDesiredFields returns the sorted paths of the fields set in the desired
+// object which differ in the live object. Fields which are only present in
+// the live object, like the ones defaulted by the API server, are ignored
+func diffDesiredFields(live, desired map[string]interface{}) []string {
+	var paths []string
+	diffDesired("", live, desired, &paths)
+	sort.Strings(paths)
+	return paths
+}
+
+func diffDesired(prefix string, live, desired map[string]interface{}, paths *[]string) {
+	for k, dv := range desired {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if isIgnoredField(path) {
+			continue
+		}
+
+		l, lok := live[k].(map[string]interface{})
+		d, dok := dv.(map[string]interface{})
+		if lok && dok {
+			diffDesired(path, l, d, paths)
+			continue
+		}
+		if !desiredEqual(live[k], dv) {
+			*paths = append(*paths, path)
+		}
+	}
+}
+
+// desiredEqual reports whether the live value holds the desired one. Only
+// the fields set in the desired maps, including the ones of the elements of
+// the lists, are compared, so that the fields defaulted by the API server
+// are not reported. The numbers are compared by value since the manifests
+// are decoded with float64 numbers and the live objects with int64 ones
+func desiredEqual(live, desired interface{}) bool {
+	switch d := desired.(type) {
+	case nil:
+		return isEmptyValue(live)
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return len(d) == 0 && isEmptyValue(live)
+		}
+		for k, dv := range d {
+			if !desiredEqual(l[k], dv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			return len(d) == 0 && isEmptyValue(live)
+		}
+		if len(l) != len(d) {
+			return false
+		}
+		for i := range d {
+			if !desiredEqual(l[i], d[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if dn, ok := numberValue(desired); ok {
+		ln, ok := numberValue(live)
+		return ok && ln == dn
+	}
+	return reflect.DeepEqual(live, desired)
+}
+
+// isEmptyValue reports whether the value is unset or an empty map or list
+func isEmptyValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// numberValue returns the value of the numbers decoded from JSON or YAML
+func numberValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func isIgnoredField(path string) bool {
+	for _, f := range ignoredFields {
+		if path == f {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldManager is the name of the field manager of the objects applied
+// by the adapter with server-side apply
+const fieldManager = "meshery-nsm"
+
+// manifestApply configures the application of the manifests of an operation
+type manifestApply struct {
+	// Strict stops at the first object which fails instead of
+	// ignoring the failure
+	Strict bool
+	// Rollback deletes the objects created by the manifest when one of
+	// its objects fails, it only applies to strict manifests
+	Rollback bool
+	// ForceConflicts takes over the fields of the objects which are
+	// managed by other field managers instead of failing
+	ForceConflicts bool
+	// FieldManager is the field manager of the applied objects, it
+	// defaults to the field manager of the adapter
+	FieldManager string
+}
+
+// manager returns the field manager of the applied objects
+func (cfg manifestApply) manager() string {
+	if cfg.FieldManager != "" {
+		return cfg.FieldManager
+	}
+	return fieldManager
+}
+
+type manifestApplyKey struct{}
+
+// withManifestApply returns a context which applies the manifests with
+// the configuration
+func withManifestApply(ctx context.Context, cfg manifestApply) context.Context {
+	return context.WithValue(ctx, manifestApplyKey{}, cfg)
+}
+
+// manifestApplyFrom returns the manifest apply configuration of the
+// operation, the zero value if none is set
+func manifestApplyFrom(ctx context.Context) manifestApply {
+	cfg, _ := ctx.Value(manifestApplyKey{}).(manifestApply)
+	return cfg
+}
+
+// applyOrder is the order in which the objects of a manifest are applied
+// by kind, so that the objects are applied after the ones they depend on.
+// Objects of other kinds, like the NSM custom resources, are applied last
+// and the objects are deleted in the reverse order
+var applyOrder = []string{
+	"Namespace",
+	"ResourceQuota",
+	"LimitRange",
+	"NetworkPolicy",
+	"CustomResourceDefinition",
+	"ServiceAccount",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"Secret",
+	"ConfigMap",
+	"StorageClass",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"Service",
+	"DaemonSet",
+	"Deployment",
+	"StatefulSet",
+	"ReplicaSet",
+	"Pod",
+	"Job",
+	"CronJob",
+	"HorizontalPodAutoscaler",
+	"PodDisruptionBudget",
+	"Ingress",
+	"APIService",
+	"MutatingWebhookConfiguration",
+	"ValidatingWebhookConfiguration",
+}
+
+// crdEstablishedTimeout is the time to wait for a CRD to be established
+// before applying the custom resources of the manifest
+const crdEstablishedTimeout = time.Minute
+
+// sortObjects sorts the objects in the apply order, or in the reverse
+// order for deletes. Objects of the same kind keep the manifest order
+func sortObjects(objects []*unstructured.Unstructured, isDel bool) {
+	rank := func(obj *unstructured.Unstructured) int {
+		for i, kind := range applyOrder {
+			if obj.GetKind() == kind {
+				return i
+			}
+		}
+		return len(applyOrder)
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		if isDel {
+			return rank(objects[i]) > rank(objects[j])
+		}
+		return rank(objects[i]) < rank(objects[j])
+	})
+}
+
+// applyObjects applies or deletes the objects of the manifest in the apply
+// order, waiting for CRDs to be established before applying the objects
+// which follow them. Unless the manifest is strict, failing objects are
+// logged and skipped, otherwise it stops at the first object which fails
+// and deletes the objects created before the failure when rollback is requested
+func (mesh *Mesh) applyObjects(ctx context.Context, kClient *mesherykube.Client, cluster string, contents []byte, isDel bool, namespace string, cfg manifestApply) (err error) {
+	objects, err := decodeManifest(contents)
+	if err != nil {
+		return err
+	}
+	sortObjects(objects, isDel)
+
+	ctx, span := tracing.Start(ctx, "manifest.apply",
+		label.String("cluster", cluster),
+		label.Int("objects", len(objects)),
+		label.Bool("delete", isDel),
+	)
+	defer func() { tracing.End(ctx, span, err) }()
+
+	mapper := newRESTMapper(kClient)
+	var created []*unstructured.Unstructured
+	for _, obj := range objects {
+		isNew, err := applyObject(ctx, kClient, mapper, obj, isDel, namespace, cfg)
+		if isNew {
+			created = append(created, obj)
+		}
+		if err == nil && !isDel && obj.GetKind() == "CustomResourceDefinition" {
+			err = waitForCRD(ctx, kClient, obj.GetName())
+			// The mapper must discover the kinds defined by the CRD
+			meta.MaybeResetRESTMapper(mapper)
+		}
+		if err == nil {
+			continue
+		}
+
+		if conflicts := fieldConflicts(err); len(conflicts) != 0 {
+			err = ErrFieldConflict(cluster, objectRef(obj), conflicts)
+		} else {
+			err = ErrApplyObject(cluster, objectRef(obj), err)
+		}
+		if !cfg.Strict {
+			span.RecordError(ctx, err)
+			mesh.Log.Warn(err)
+			continue
+		}
+		if !cfg.Rollback || len(created) == 0 {
+			return err
+		}
+		if rerr := rollbackObjects(ctx, kClient, mapper, created, namespace); rerr != nil {
+			return mergeErrors([]error{err, ErrRollback(cluster, rerr)})
+		}
+		return err
+	}
+	return nil
+}
+
+// waitForCRD waits for the CRD to be established
+func waitForCRD(ctx context.Context, kClient *mesherykube.Client, name string) error {
+	crds := kClient.DynamicKubeClient.Resource(schema.GroupVersionResource{
+		Group:    "apiextensions.k8s.io",
+		Version:  "v1",
+		Resource: "customresourcedefinitions",
+	})
+	return wait.PollImmediate(time.Second, crdEstablishedTimeout, func() (bool, error) {
+		crd, err := crds.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+		for _, c := range conditions {
+			cond, ok := c.(map[string]interface{})
+			if ok && cond["type"] == "Established" && cond["status"] == "True" {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+// applyObject applies, with server-side apply, or deletes a single object
+// and returns whether the object did not exist and was created
+func applyObject(ctx context.Context, kClient *mesherykube.Client, mapper meta.RESTMapper, obj *unstructured.Unstructured, isDel bool, namespace string, cfg manifestApply) (bool, error) {
+	ri, err := resourceFor(kClient, mapper, obj, namespace)
+	if err != nil {
+		return false, err
+	}
+
+	if isDel {
+		err := ri.Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
+		if kubeerror.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	_, err = ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil && !kubeerror.IsNotFound(err) {
+		return false, err
+	}
+	isNew := err != nil
+
+	_, err = ri.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+		FieldManager: cfg.manager(),
+		Force:        cfg.ForceConflicts,
+	})
+	return isNew && err == nil, err
+}
+
+// fieldConflicts returns the field manager conflicts of a failed
+// server-side apply, describing the field and its manager
+func fieldConflicts(err error) []string {
+	if !kubeerror.IsConflict(err) {
+		return nil
+	}
+	var status kubeerror.APIStatus
+	if !errors.As(err, &status) || status.Status().Details == nil {
+		return nil
+	}
+
+	var conflicts []string
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type == metav1.CauseTypeFieldManagerConflict {
+			conflicts = append(conflicts, cause.Message)
+		}
+	}
+	return conflicts
+}
+
+// rollbackObjects deletes the created objects in reverse order
+func rollbackObjects(ctx context.Context, kClient *mesherykube.Client, mapper meta.RESTMapper, created []*unstructured.Unstructured, namespace string) error {
+	var errs []error
+	for i := len(created) - 1; i >= 0; i-- {
+		if _, err := applyObject(ctx, kClient, mapper, created[i], true, namespace, manifestApply{}); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", objectRef(created[i]), err))
+		}
+	}
+	return mergeErrors(errs)
+}
@@ -0,0 +1,179 @@
+package nsm
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const desiredDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nsmgr
+  namespace: nsm-system
+  labels:
+    app: nsmgr
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: nsmgr
+  template:
+    metadata:
+      labels:
+        app: nsmgr
+    spec:
+      initContainers:
+        - name: init
+          image: busybox
+      containers:
+        - name: nsmgr
+          image: ghcr.io/networkservicemesh/cmd-nsmgr:v1.6.0
+          ports:
+            - containerPort: 5001
+          env:
+            - name: NSM_LOG_LEVEL
+              value: TRACE
+`
+
+// liveDeployment is the desired deployment as returned by the API server,
+// with the fields it manages and defaults
+const liveDeployment = `{
+  "apiVersion": "apps/v1",
+  "kind": "Deployment",
+  "metadata": {
+    "name": "nsmgr",
+    "namespace": "nsm-system",
+    "labels": {"app": "nsmgr"},
+    "annotations": {"deployment.kubernetes.io/revision": "1"},
+    "creationTimestamp": "2022-10-19T00:00:00Z",
+    "generation": 1,
+    "resourceVersion": "1234",
+    "uid": "b8b3f4a2-6f0e-4c7e-9d1c-0f8f2d7f5c1a",
+    "managedFields": [{"manager": "helm", "operation": "Update"}]
+  },
+  "spec": {
+    "replicas": %d,
+    "revisionHistoryLimit": 10,
+    "progressDeadlineSeconds": 600,
+    "selector": {"matchLabels": {"app": "nsmgr"}},
+    "strategy": {"type": "RollingUpdate", "rollingUpdate": {"maxSurge": "25%%", "maxUnavailable": "25%%"}},
+    "template": {
+      "metadata": {"creationTimestamp": null, "labels": {"app": "nsmgr"}},
+      "spec": {
+        "initContainers": [{
+          "name": "init",
+          "image": "busybox",
+          "imagePullPolicy": "Always",
+          "resources": {},
+          "terminationMessagePath": "/dev/termination-log",
+          "terminationMessagePolicy": "File"
+        }],
+        "containers": [{
+          "name": "nsmgr",
+          "image": "%s",
+          "imagePullPolicy": "IfNotPresent",
+          "ports": [{"containerPort": 5001, "protocol": "TCP"}],
+          "env": [{"name": "NSM_LOG_LEVEL", "value": "TRACE"}],
+          "resources": {},
+          "terminationMessagePath": "/dev/termination-log",
+          "terminationMessagePolicy": "File"
+        }],
+        "dnsPolicy": "ClusterFirst",
+        "restartPolicy": "Always",
+        "schedulerName": "default-scheduler",
+        "securityContext": {},
+        "terminationGracePeriodSeconds": 30
+      }
+    }
+  },
+  "status": {"replicas": 1, "readyReplicas": 1}
+}`
+
+// liveObject decodes the JSON object as the dynamic client does, with
+// int64 numbers
+func liveObject(t *testing.T, data string) *unstructured.Unstructured {
+	t.Helper()
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func desiredObject(t *testing.T, manifest string) *unstructured.Unstructured {
+	t.Helper()
+	objects, err := decodeManifest([]byte(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 {
+		t.Fatalf("decoded %d objects, want 1", len(objects))
+	}
+	return objects[0]
+}
+
+func TestDiffDesiredFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas int
+		image    string
+		want     []string
+	}{
+		{
+			name:     "unchanged",
+			replicas: 1,
+			image:    "ghcr.io/networkservicemesh/cmd-nsmgr:v1.6.0",
+		},
+		{
+			name:     "scaled",
+			replicas: 3,
+			image:    "ghcr.io/networkservicemesh/cmd-nsmgr:v1.6.0",
+			want:     []string{"spec.replicas"},
+		},
+		{
+			name:     "image changed",
+			replicas: 1,
+			image:    "ghcr.io/networkservicemesh/cmd-nsmgr:v1.5.0",
+			want:     []string{"spec.template.spec.containers"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := liveObject(t, fmt.Sprintf(liveDeployment, tt.replicas, tt.image))
+			desired := desiredObject(t, desiredDeployment)
+			if got := diffDesiredFields(live.Object, desired.Object); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffDesiredFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDesiredEqual(t *testing.T) {
+	tests := []struct {
+		name    string
+		live    interface{}
+		desired interface{}
+		want    bool
+	}{
+		{"float and int numbers", int64(1), float64(1), true},
+		{"different numbers", int64(2), float64(1), false},
+		{"number and string", "1", float64(1), false},
+		{"unset desired", nil, nil, true},
+		{"empty desired map", nil, map[string]interface{}{}, true},
+		{"defaulted map field", map[string]interface{}{"a": "x", "b": "y"}, map[string]interface{}{"a": "x"}, true},
+		{"missing map field", map[string]interface{}{"b": "y"}, map[string]interface{}{"a": "x"}, false},
+		{"defaulted list element field", []interface{}{map[string]interface{}{"a": "x", "b": "y"}}, []interface{}{map[string]interface{}{"a": "x"}}, true},
+		{"extra list element", []interface{}{"x", "y"}, []interface{}{"x"}, false},
+		{"reordered list", []interface{}{"y", "x"}, []interface{}{"x", "y"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := desiredEqual(tt.live, tt.desired); got != tt.want {
+				t.Errorf("desiredEqual(%v, %v) = %v, want %v", tt.live, tt.desired, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,547 @@
+package nsm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/layer5io/meshery-adapter-library/meshes"
+	internalconfig "github.com/layer5io/meshery-nsm/internal/config"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	smp "github.com/layer5io/service-mesh-performance/spec"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// benchmarkImageTag is the tag of the NSM images of the benchmark
+	// when the installed NSM version is not found
+	benchmarkImageTag = "v1.6.1"
+
+	// benchmarkCIDR is the address range the benchmark NSEs hand out, the
+	// NSE takes the first address and its client the second one
+	benchmarkCIDR = "172.16.1.100/31"
+
+	// benchmarkTarget is the address of the benchmark NSEs
+	benchmarkTarget = "172.16.1.100"
+
+	// benchmarkReadyTimeout is the time to wait for the connection of the
+	// benchmark client to its NSE
+	benchmarkReadyTimeout = 5 * time.Minute
+
+	// defaultBenchmarkSamples is the number of echo requests the latency
+	// of each datapath is measured with
+	defaultBenchmarkSamples = 100
+
+	// defaultBenchmarkDuration is the duration of the throughput
+	// measurement of each datapath
+	defaultBenchmarkDuration = 10 * time.Second
+
+	// benchmarkInterval is the interval between the echo requests of the
+	// latency measurement, in seconds
+	benchmarkInterval = "0.05"
+
+	// smpVersion is the version of the SMP specification of the results
+	smpVersion = "v0.0.1"
+
+	// throughputUnavailable is the throughput label of the datapaths whose
+	// throughput is not measured
+	throughputUnavailable = "unavailable"
+)
+
+// Mechanisms of the connections of the benchmark clients
+const (
+	mechanismKernel = "kernel"
+	mechanismMemif  = "memif"
+)
+
+// rttRegexp matches the round-trip time of an echo reply of ping or of
+// the ping of vppctl, which prints times below a millisecond as ".0697"
+var rttRegexp = regexp.MustCompile(`time=([\d.]+) ms`)
+
+// datapath describes a datapath of the benchmark, by the mechanism of its
+// client and the NSE at its other end. The forwarder between them is the
+// one installed on the cluster, which the results are labeled with
+type datapath struct {
+	// Name is the name of the datapath
+	Name string
+	// Mechanism is the mechanism of the connection of the client
+	Mechanism string
+	// NSEImage is the image of the NSE, without its tag
+	NSEImage string
+	// Iperf measures the throughput of the datapath with iperf3, which
+	// requires kernel interfaces on both ends. The throughput of the other
+	// datapaths is labeled as unavailable
+	Iperf bool
+}
+
+// datapaths maps the datapath names to the datapaths
+var datapaths = map[string]datapath{
+	// kernel connects a kernel client to a kernel NSE
+	"kernel": {
+		Name:      "kernel",
+		Mechanism: mechanismKernel,
+		NSEImage:  "cmd-nse-icmp-responder",
+		Iperf:     true,
+	},
+	// memif connects a VPP client to a VPP NSE over shared memory
+	"memif": {
+		Name:      "memif",
+		Mechanism: mechanismMemif,
+		NSEImage:  "cmd-nse-icmp-responder-vpp",
+	},
+	// vpp connects a kernel client to a VPP NSE, it differs from kernel
+	// by the NSE only
+	"vpp": {
+		Name:      "vpp",
+		Mechanism: mechanismKernel,
+		NSEImage:  "cmd-nse-icmp-responder-vpp",
+	},
+}
+
+// benchmarkTemplate is the manifest of the network service, NSE and
+// client of a datapath of the benchmark
+var benchmarkTemplate = template.Must(template.New("benchmark").Parse(`---
+apiVersion: networkservicemesh.io/v1
+kind: NetworkService
+metadata:
+  name: {{ .Name }}
+spec:
+  payload: IP
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Name }}-nse
+  labels:
+    app: {{ .Name }}-nse
+spec:
+  selector:
+    matchLabels:
+      app: {{ .Name }}-nse
+  template:
+    metadata:
+      labels:
+        app: {{ .Name }}-nse
+    spec:
+      containers:
+        - name: nse
+          image: ghcr.io/networkservicemesh/{{ .Path.NSEImage }}:{{ .Tag }}
+          imagePullPolicy: IfNotPresent
+          env:
+            - name: NSM_CIDR_PREFIX
+              value: {{ .CIDR }}
+            - name: NSM_SERVICE_NAMES
+              value: {{ .Name }}
+            - name: NSM_REGISTER_SERVICE
+              value: "false"
+            - name: NSM_NAME
+              valueFrom:
+                fieldRef:
+                  fieldPath: metadata.name
+            - name: SPIFFE_ENDPOINT_SOCKET
+              value: unix:///run/spire/sockets/agent.sock
+            - name: NSM_CONNECT_TO
+              value: unix:///var/lib/networkservicemesh/nsm.io.sock
+          volumeMounts:
+            - name: spire-agent-socket
+              mountPath: /run/spire/sockets
+              readOnly: true
+            - name: nsm-socket
+              mountPath: /var/lib/networkservicemesh
+              readOnly: true
+{{- if .Path.Iperf }}
+        - name: iperf
+          image: {{ .TestImage }}
+          imagePullPolicy: IfNotPresent
+          command: ["iperf3", "-s"]
+{{- end }}
+      volumes:
+        - name: spire-agent-socket
+          hostPath:
+            path: /run/spire/sockets
+            type: Directory
+        - name: nsm-socket
+          hostPath:
+            path: /var/lib/networkservicemesh
+            type: DirectoryOrCreate
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Name }}-nsc
+  labels:
+    app: {{ .Name }}-nsc
+spec:
+  selector:
+    matchLabels:
+      app: {{ .Name }}-nsc
+  template:
+    metadata:
+      labels:
+        app: {{ .Name }}-nsc
+{{- if eq .Path.Mechanism "kernel" }}
+      annotations:
+        networkservicemesh.io: kernel://{{ .Name }}/nsm-1
+{{- end }}
+    spec:
+      containers:
+{{- if eq .Path.Mechanism "kernel" }}
+        - name: client
+          image: {{ .TestImage }}
+          imagePullPolicy: IfNotPresent
+          command: ["sleep", "infinity"]
+          securityContext:
+            capabilities:
+              add: ["NET_RAW"]
+{{- else }}
+        - name: client
+          image: ghcr.io/networkservicemesh/cmd-nsc-vpp:{{ .Tag }}
+          imagePullPolicy: IfNotPresent
+          env:
+            - name: NSM_NETWORK_SERVICES
+              value: memif://{{ .Name }}/nsm-1
+            - name: NSM_NAME
+              valueFrom:
+                fieldRef:
+                  fieldPath: metadata.name
+            - name: SPIFFE_ENDPOINT_SOCKET
+              value: unix:///run/spire/sockets/agent.sock
+            - name: NSM_CONNECT_TO
+              value: unix:///var/lib/networkservicemesh/nsm.io.sock
+          volumeMounts:
+            - name: spire-agent-socket
+              mountPath: /run/spire/sockets
+              readOnly: true
+            - name: nsm-socket
+              mountPath: /var/lib/networkservicemesh
+              readOnly: true
+      volumes:
+        - name: spire-agent-socket
+          hostPath:
+            path: /run/spire/sockets
+            type: Directory
+        - name: nsm-socket
+          hostPath:
+            path: /var/lib/networkservicemesh
+            type: DirectoryOrCreate
+{{- end }}
+`))
+
+// benchmarkValues holds the values of the benchmark template
+type benchmarkValues struct {
+	Name      string
+	Path      datapath
+	CIDR      string
+	Tag       string
+	TestImage string
+}
+
+// benchmarkOptions are the options of the benchmark
+type benchmarkOptions struct {
+	// Paths are the names of the datapaths benchmarked, all of them when
+	// not set
+	Paths []string `json:"paths,omitempty"`
+	// Samples is the number of echo requests the latency of each
+	// datapath is measured with
+	Samples int `json:"samples,omitempty"`
+	// Duration is the duration of the throughput measurement of each
+	// datapath, e.g. 30s
+	Duration string `json:"duration,omitempty"`
+	// Image is the test image providing ping and iperf3
+	Image string `json:"image,omitempty"`
+	// Keep keeps the benchmark workloads once the benchmark is done
+	Keep bool `json:"keep,omitempty"`
+	// Cluster is the index of the kubeconfig of the cluster benchmarked
+	Cluster int `json:"cluster,omitempty"`
+}
+
+// benchmarkDatapaths deploys a client and an NSE connected over each of
+// the datapaths on the cluster, measures the latency and, where possible,
+// the throughput of their connection and streams the result of each
+// datapath in the SMP performance result format
+func (mesh *Mesh) benchmarkDatapaths(ctx context.Context, opID, namespace string, opts benchmarkOptions, kubeconfigs []string) ([]*smp.PerformanceTestResult, error) {
+	if opts.Cluster < 0 || opts.Cluster >= len(kubeconfigs) {
+		return nil, ErrBenchmark(fmt.Errorf("cluster index %d out of range", opts.Cluster))
+	}
+	if len(opts.Paths) == 0 {
+		opts.Paths = []string{"kernel", "memif", "vpp"}
+	}
+	if opts.Samples <= 0 {
+		opts.Samples = defaultBenchmarkSamples
+	}
+	duration := defaultBenchmarkDuration
+	if opts.Duration != "" {
+		d, err := time.ParseDuration(opts.Duration)
+		if err != nil {
+			return nil, ErrBenchmark(err)
+		}
+		duration = d
+	}
+
+	paths := make([]datapath, 0, len(opts.Paths))
+	for _, name := range opts.Paths {
+		dp, ok := datapaths[name]
+		if !ok {
+			return nil, ErrBenchmark(fmt.Errorf("unsupported datapath: %s", name))
+		}
+		paths = append(paths, dp)
+	}
+
+	config := kubeconfigs[opts.Cluster]
+	cluster := clusterName(opts.Cluster)
+	kClient, err := mesherykube.New([]byte(config))
+	if err != nil {
+		return nil, ErrBenchmark(err)
+	}
+	forwarder := "unknown"
+	if dryRunFrom(ctx) == nil {
+		found, err := clusterForwarders(kClient, metav1.NamespaceAll)
+		if err != nil {
+			mesh.Log.Warn(ErrBenchmark(err))
+		} else if len(found) != 0 {
+			forwarder = strings.Join(found, ",")
+		}
+	}
+
+	tag := nsmImageTag(ctx, kClient, benchmarkImageTag)
+
+	var results []*smp.PerformanceTestResult
+	for _, dp := range paths {
+		values := benchmarkValues{
+			Name:      "nsm-bench-" + dp.Name,
+			Path:      dp,
+			CIDR:      benchmarkCIDR,
+			Tag:       tag,
+			TestImage: opts.Image,
+		}
+		var manifest bytes.Buffer
+		if err := benchmarkTemplate.Execute(&manifest, values); err != nil {
+			return results, ErrBenchmark(err)
+		}
+		if err := mesh.applyManifestToCluster(ctx, cluster, config, manifest.Bytes(), false, namespace); err != nil {
+			return results, ErrBenchmark(fmt.Errorf("%s: %s", dp.Name, err))
+		}
+		if report := dryRunFrom(ctx); report != nil {
+			report.record(plannedChange{Cluster: cluster, Action: plannedRun, Object: fmt.Sprintf("%s datapath benchmark", dp.Name)})
+			continue
+		}
+
+		result, err := benchmarkDatapath(kClient, namespace, values, opts.Samples, duration)
+		if !opts.Keep {
+			if derr := mesh.applyManifestToCluster(ctx, cluster, config, manifest.Bytes(), true, namespace); derr != nil {
+				mesh.Log.Warn(ErrBenchmark(fmt.Errorf("%s: %s", dp.Name, derr)))
+			}
+		}
+		if err != nil {
+			return results, ErrBenchmark(fmt.Errorf("%s: %s", dp.Name, err))
+		}
+
+		result.TestId = opID
+		result.Labels["cluster"] = kubeContextName(config, cluster)
+		result.Labels["forwarder"] = forwarder
+		results = append(results, result)
+		mesh.streamBenchmarkResult(opID, result)
+	}
+	return results, nil
+}
+
+// benchmarkDatapath measures the latency and the throughput of the
+// connection of the benchmark client to its NSE
+func benchmarkDatapath(kClient *mesherykube.Client, namespace string, values benchmarkValues, samples int, duration time.Duration) (*smp.PerformanceTestResult, error) {
+	dp := values.Path
+	pod, err := waitForConnection(kClient, namespace, values)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	rtts, err := pingNSE(kClient, namespace, pod, dp, samples)
+	if err != nil {
+		return nil, err
+	}
+	end := time.Now()
+
+	result := &smp.PerformanceTestResult{
+		SmpVersion: smpVersion,
+		Id:         uuid.New().String(),
+		Labels: map[string]string{
+			"mesh":           smp.ServiceMesh_NETWORK_SERVICE_MESH.String(),
+			"datapath":       dp.Name,
+			"mechanism":      dp.Mechanism,
+			"nse":            dp.NSEImage,
+			"load_generator": "ping",
+			"samples":        strconv.Itoa(samples),
+			"received":       strconv.Itoa(len(rtts)),
+			"packet_loss":    strconv.FormatFloat(100*float64(samples-len(rtts))/float64(samples), 'f', 2, 64),
+		},
+		StartTime:   timestamppb.New(start),
+		LatenciesMs: latencySummary(rtts),
+		ActualQps:   float64(len(rtts)) / end.Sub(start).Seconds(),
+	}
+
+	if dp.Iperf {
+		out, err := execInPod(kClient, namespace, pod, "client", []string{
+			"iperf3", "-c", benchmarkTarget, "-t", strconv.Itoa(int(duration.Seconds())), "-J",
+		}, nil)
+		bandwidth, perr := parseIperf(out)
+		if perr != nil {
+			if err == nil {
+				err = perr
+			}
+			return nil, err
+		}
+		result.Labels["load_generator"] = "ping,iperf3"
+		result.Labels["throughput_bps"] = strconv.FormatFloat(bandwidth, 'f', 0, 64)
+		end = time.Now()
+	} else {
+		result.Labels["throughput_bps"] = throughputUnavailable
+	}
+	result.EndTime = timestamppb.New(end)
+	return result, nil
+}
+
+// pingCommand returns the command sending count echo requests to the NSE
+// from the client of the datapath
+func pingCommand(dp datapath, count int) []string {
+	if dp.Mechanism == mechanismMemif {
+		return []string{"vppctl", "ping", benchmarkTarget, "repeat", strconv.Itoa(count), "interval", benchmarkInterval}
+	}
+	return []string{"ping", "-c", strconv.Itoa(count), "-i", benchmarkInterval, "-W", "1", benchmarkTarget}
+}
+
+// pingNSE sends count echo requests to the NSE from the client pod of the
+// datapath and returns the round-trip times of the replies
+func pingNSE(kClient *mesherykube.Client, namespace, pod string, dp datapath, count int) ([]float64, error) {
+	out, err := execInPod(kClient, namespace, pod, "client", pingCommand(dp, count), nil)
+	rtts := parseRTTs(out)
+	// ping exits with an error when packets are lost
+	if len(rtts) == 0 && err != nil {
+		return nil, err
+	}
+	return rtts, nil
+}
+
+// waitForConnection waits for the client of the datapath workloads to be
+// connected to its NSE, that is for the NSE to reply to the client, and
+// returns the name of the client pod
+func waitForConnection(kClient *mesherykube.Client, namespace string, values benchmarkValues) (string, error) {
+	var pod string
+	err := wait.PollImmediate(5*time.Second, benchmarkReadyTimeout, func() (bool, error) {
+		var err error
+		if pod, err = findRunningPod(kClient, namespace, "app="+values.Name+"-nsc"); err != nil {
+			return false, nil
+		}
+		rtts, _ := pingNSE(kClient, namespace, pod, values.Path, 1)
+		return len(rtts) != 0, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("client did not connect to %s: %s", benchmarkTarget, err)
+	}
+	return pod, nil
+}
+
+// parseRTTs returns the round-trip times of the echo replies in the
+// output of ping, in milliseconds
+func parseRTTs(out string) []float64 {
+	var rtts []float64
+	for _, m := range rttRegexp.FindAllStringSubmatch(out, -1) {
+		if rtt, err := strconv.ParseFloat(m[1], 64); err == nil {
+			rtts = append(rtts, rtt)
+		}
+	}
+	return rtts
+}
+
+// latencySummary returns the SMP latency summary of the round-trip times
+func latencySummary(rtts []float64) *smp.PerformanceTestResult_Latency {
+	if len(rtts) == 0 {
+		return &smp.PerformanceTestResult_Latency{}
+	}
+	sorted := append([]float64(nil), rtts...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, rtt := range sorted {
+		sum += rtt
+	}
+	return &smp.PerformanceTestResult_Latency{
+		Min:     sorted[0],
+		Average: sum / float64(len(sorted)),
+		P50:     percentile(sorted, 50),
+		P90:     percentile(sorted, 90),
+		P99:     percentile(sorted, 99),
+		Max:     sorted[len(sorted)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile of the sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// marshalBenchmarkResults encodes the SMP performance results as a JSON
+// array, with the field names of the SMP specification
+func marshalBenchmarkResults(results []*smp.PerformanceTestResult) ([]byte, error) {
+	encoded := make([]json.RawMessage, 0, len(results))
+	for _, r := range results {
+		data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, data)
+	}
+	return json.Marshal(encoded)
+}
+
+// benchmarkSummary summarizes the latency and throughput of the datapaths
+func benchmarkSummary(results []*smp.PerformanceTestResult) string {
+	parts := make([]string, 0, len(results))
+	for _, r := range results {
+		part := fmt.Sprintf("%s p50 %.3fms p99 %.3fms", r.Labels["datapath"], r.LatenciesMs.GetP50(), r.LatenciesMs.GetP99())
+		switch bps := r.Labels["throughput_bps"]; bps {
+		case "":
+		case throughputUnavailable:
+			part += " throughput " + throughputUnavailable
+		default:
+			if v, err := strconv.ParseFloat(bps, 64); err == nil {
+				part += fmt.Sprintf(" %.2fGbps", v/1e9)
+			}
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// streamBenchmarkResult streams the SMP performance result of a datapath
+func (mesh *Mesh) streamBenchmarkResult(opID string, result *smp.PerformanceTestResult) {
+	e := &meshes.EventsResponse{
+		OperationId:   opID,
+		Component:     internalconfig.ServerConfig["type"],
+		ComponentName: internalconfig.ServerConfig["name"],
+	}
+
+	details, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(result)
+	if err != nil {
+		mesh.streamErr("Error while encoding benchmark result", e, ErrBenchmark(err))
+		return
+	}
+	e.Summary = fmt.Sprintf("Benchmarked datapath %s", benchmarkSummary([]*smp.PerformanceTestResult{result}))
+	e.Details = string(details)
+	mesh.StreamInfo(e)
+}
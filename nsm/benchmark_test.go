@@ -0,0 +1,102 @@
+package nsm
+
+import (
+	"reflect"
+	"testing"
+
+	smp "github.com/layer5io/service-mesh-performance/spec"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		name   string
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{name: "p0", sorted: sorted, p: 0, want: 1},
+		{name: "p50", sorted: sorted, p: 50, want: 5},
+		{name: "p90", sorted: sorted, p: 90, want: 9},
+		{name: "p99", sorted: sorted, p: 99, want: 10},
+		{name: "p100", sorted: sorted, p: 100, want: 10},
+		{name: "between ranks", sorted: sorted, p: 55, want: 6},
+		{name: "single value", sorted: []float64{0.42}, p: 99, want: 0.42},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentile(tt.sorted, tt.p); got != tt.want {
+				t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatencySummary(t *testing.T) {
+	tests := []struct {
+		name string
+		rtts []float64
+		want *smp.PerformanceTestResult_Latency
+	}{
+		{
+			name: "no replies",
+			want: &smp.PerformanceTestResult_Latency{},
+		},
+		{
+			name: "unsorted round-trip times",
+			rtts: []float64{0.4, 0.1, 0.3, 0.2},
+			want: &smp.PerformanceTestResult_Latency{Min: 0.1, Average: 0.25, P50: 0.2, P90: 0.4, P99: 0.4, Max: 0.4},
+		},
+		{
+			name: "single reply",
+			rtts: []float64{1.5},
+			want: &smp.PerformanceTestResult_Latency{Min: 1.5, Average: 1.5, P50: 1.5, P90: 1.5, P99: 1.5, Max: 1.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rtts := append([]float64(nil), tt.rtts...)
+			if got := latencySummary(tt.rtts); !proto.Equal(got, tt.want) {
+				t.Errorf("latencySummary() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.rtts, rtts) {
+				t.Errorf("latencySummary() reordered the round-trip times to %v", tt.rtts)
+			}
+		})
+	}
+}
+
+func TestParseRTTs(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want []float64
+	}{
+		{
+			name: "ping",
+			out: `PING 172.16.1.100 (172.16.1.100) 56(84) bytes of data.
+64 bytes from 172.16.1.100: icmp_seq=1 ttl=64 time=0.417 ms
+64 bytes from 172.16.1.100: icmp_seq=2 ttl=64 time=1.02 ms`,
+			want: []float64{0.417, 1.02},
+		},
+		{
+			name: "vppctl ping",
+			out: `116 bytes from 172.16.1.100: icmp_seq=1 ttl=64 time=.0697 ms
+116 bytes from 172.16.1.100: icmp_seq=2 ttl=64 time=.0512 ms`,
+			want: []float64{0.0697, 0.0512},
+		},
+		{
+			name: "no reply",
+			out:  "From 172.16.1.101 icmp_seq=1 Destination Host Unreachable",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRTTs(tt.out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRTTs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package nsm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/meshes"
+	internalconfig "github.com/layer5io/meshery-nsm/internal/config"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// connectivityContainerPrefix is the name prefix of the ephemeral
+	// containers running the connectivity checks
+	connectivityContainerPrefix = "nsm-conncheck-"
+
+	// connectivityStartTimeout is the time to wait for the ephemeral
+	// container running the connectivity checks to start
+	connectivityStartTimeout = 2 * time.Minute
+
+	// defaultPingCount is the number of echo requests sent by the ping check
+	defaultPingCount = 5
+
+	// defaultIperfDuration is the duration of the iperf check in seconds
+	defaultIperfDuration = 5
+)
+
+var (
+	// pingLossRegexp matches the packet loss summary of ping
+	pingLossRegexp = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received.*?([\d.]+)% packet loss`)
+	// pingRTTRegexp matches the round-trip time summary of ping
+	pingRTTRegexp = regexp.MustCompile(`min/avg/max(?:/mdev|/stddev)? = ([\d.]+)/([\d.]+)/([\d.]+)`)
+)
+
+// connectivityOptions are the options of the connectivity test
+type connectivityOptions struct {
+	// Pod is the name of the NSC pod the checks are run from
+	Pod string `json:"pod,omitempty"`
+	// PodNamespace is the namespace of the NSC pod, it defaults to the
+	// namespace of the operation
+	PodNamespace string `json:"podNamespace,omitempty"`
+	// Container is the container of the pod the checks are run in. When
+	// it is not set, the checks are run in an ephemeral container of the
+	// test image, which is added to the pod by the first test and reused
+	// by the following ones
+	Container string `json:"container,omitempty"`
+	// Image is the test image providing ping and iperf3
+	Image string `json:"image,omitempty"`
+	// Target is the address checked, it defaults to the address of the
+	// NSE the pod is connected to
+	Target string `json:"target,omitempty"`
+	// Count is the number of echo requests sent by the ping check
+	Count int `json:"count,omitempty"`
+	// MaxLoss is the packet loss percentage above which the ping check fails
+	MaxLoss float64 `json:"maxLoss,omitempty"`
+	// Iperf runs a bandwidth check against an iperf3 server on the target
+	Iperf bool `json:"iperf,omitempty"`
+	// Cluster is the index of the kubeconfig of the cluster of the pod
+	Cluster int `json:"cluster,omitempty"`
+}
+
+// connectivityCheck is the result of a single connectivity check
+type connectivityCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	// Transmitted, Received and Loss are the packet counts and the
+	// packet loss percentage of the ping check
+	Transmitted int     `json:"transmitted,omitempty"`
+	Received    int     `json:"received,omitempty"`
+	Loss        float64 `json:"loss"`
+	// MinRTT, AvgRTT and MaxRTT are the round-trip times of the ping
+	// check in milliseconds
+	MinRTT float64 `json:"minRtt,omitempty"`
+	AvgRTT float64 `json:"avgRtt,omitempty"`
+	MaxRTT float64 `json:"maxRtt,omitempty"`
+	// Bandwidth is the bandwidth measured by the iperf check in bits
+	// per second
+	Bandwidth float64 `json:"bandwidth,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// connectivityReport is the report of the connectivity test
+type connectivityReport struct {
+	Cluster string              `json:"cluster"`
+	Pod     string              `json:"pod"`
+	Target  string              `json:"target"`
+	Passed  bool                `json:"passed"`
+	Checks  []connectivityCheck `json:"checks"`
+}
+
+// testConnectivity runs the connectivity checks from the NSC pod against
+// the target, streaming the result of each check as an event
+func (mesh *Mesh) testConnectivity(ctx context.Context, opID string, opts connectivityOptions, kubeconfigs []string) (*connectivityReport, error) {
+	if opts.Pod == "" {
+		return nil, ErrConnectivity(fmt.Errorf("the NSC pod is not set"))
+	}
+	if opts.Cluster < 0 || opts.Cluster >= len(kubeconfigs) {
+		return nil, ErrConnectivity(fmt.Errorf("cluster index %d out of range", opts.Cluster))
+	}
+	if opts.Count <= 0 {
+		opts.Count = defaultPingCount
+	}
+
+	config := kubeconfigs[opts.Cluster]
+	cluster := clusterName(opts.Cluster)
+	kClient, err := mesherykube.New([]byte(config))
+	if err != nil {
+		return nil, ErrConnectivity(err)
+	}
+	pod, err := kClient.KubeClient.CoreV1().Pods(opts.PodNamespace).Get(ctx, opts.Pod, metav1.GetOptions{})
+	if err != nil {
+		return nil, ErrFindPod(opts.Pod, err)
+	}
+
+	container := opts.Container
+	if container == "" {
+		container = checkContainer(pod, opts.Image)
+	}
+	if dr := dryRunFrom(ctx); dr != nil {
+		if container == "" {
+			dr.record(plannedChange{
+				Cluster: cluster,
+				Action:  plannedCreate,
+				Object:  fmt.Sprintf("Pod/%s/%s ephemeral container %s*", opts.PodNamespace, opts.Pod, connectivityContainerPrefix),
+			})
+		}
+		checks := []string{"ping"}
+		if opts.Iperf {
+			checks = append(checks, "iperf")
+		}
+		for _, check := range checks {
+			dr.record(plannedChange{Cluster: cluster, Action: plannedRun, Object: fmt.Sprintf("%s check from pod %s", check, opts.Pod)})
+		}
+		return &connectivityReport{Cluster: kubeContextName(config, cluster), Pod: opts.Pod, Target: opts.Target, Passed: true}, nil
+	}
+	if container == "" {
+		container, err = addTestContainer(ctx, kClient, pod, opts.Image)
+		if err != nil {
+			return nil, err
+		}
+	}
+	exec := func(command ...string) (string, error) {
+		return execInPod(kClient, opts.PodNamespace, opts.Pod, container, command, nil)
+	}
+
+	target := opts.Target
+	if target == "" {
+		routes, err := exec("ip", "-4", "route", "show")
+		if err != nil {
+			return nil, ErrConnectivity(err)
+		}
+		if target = nseAddress(routes); target == "" {
+			return nil, ErrConnectivity(fmt.Errorf("no route to an NSE found in pod %s", opts.Pod))
+		}
+	}
+
+	report := &connectivityReport{
+		Cluster: kubeContextName(config, cluster),
+		Pod:     opts.Pod,
+		Target:  target,
+		Passed:  true,
+	}
+	run := func(check connectivityCheck) {
+		report.Checks = append(report.Checks, check)
+		report.Passed = report.Passed && check.Passed
+		mesh.streamConnectivityCheck(opID, report, check)
+	}
+
+	out, err := exec("ping", "-c", strconv.Itoa(opts.Count), "-q", target)
+	run(pingCheck(out, err, opts.MaxLoss))
+	if opts.Iperf {
+		out, err := exec("iperf3", "-c", target, "-t", strconv.Itoa(defaultIperfDuration), "-J")
+		run(iperfCheck(out, err))
+	}
+	return report, nil
+}
+
+// checkContainer returns the name of a running connectivity check
+// container of the pod with the image, empty if there is none
+func checkContainer(pod *corev1.Pod, image string) string {
+	running := make(map[string]bool, len(pod.Status.EphemeralContainerStatuses))
+	for _, cs := range pod.Status.EphemeralContainerStatuses {
+		running[cs.Name] = cs.State.Running != nil
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		if strings.HasPrefix(c.Name, connectivityContainerPrefix) && c.Image == image && running[c.Name] {
+			return c.Name
+		}
+	}
+	return ""
+}
+
+// addTestContainer adds an ephemeral container of the test image to the
+// pod, sharing its network namespace, and returns its name once it runs.
+// Ephemeral containers can not be removed from a pod, so the container
+// keeps running to be reused by the following tests
+func addTestContainer(ctx context.Context, kClient *mesherykube.Client, pod *corev1.Pod, image string) (string, error) {
+	pods := kClient.KubeClient.CoreV1().Pods(pod.Namespace)
+	name := pod.Name
+
+	container := connectivityContainerPrefix + rand.String(5)
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:            container,
+			Image:           image,
+			ImagePullPolicy: corev1.PullIfNotPresent,
+			Command:         []string{"sleep", "infinity"},
+			SecurityContext: &corev1.SecurityContext{
+				Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_RAW"}},
+			},
+		},
+	})
+	if _, err := pods.UpdateEphemeralContainers(ctx, name, pod, metav1.UpdateOptions{}); err != nil {
+		return "", ErrConnectivity(err)
+	}
+
+	err := wait.PollImmediate(2*time.Second, connectivityStartTimeout, func() (bool, error) {
+		pod, err := pods.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, cs := range pod.Status.EphemeralContainerStatuses {
+			if cs.Name == container {
+				return cs.State.Running != nil, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", ErrConnectivity(fmt.Errorf("container %s of pod %s did not start: %s", container, name, err))
+	}
+	return container, nil
+}
+
+// nseAddress returns the address of the NSE from the routes of the pod,
+// which are installed by NSM on its interfaces named nsm-*
+func nseAddress(routes string) string {
+	for _, line := range strings.Split(routes, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.Contains(line, "dev nsm") {
+			continue
+		}
+		dst := strings.TrimSuffix(fields[0], "/32")
+		if ip := net.ParseIP(dst); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// pingCheck returns the result of the ping check from the output of ping
+func pingCheck(out string, err error, maxLoss float64) connectivityCheck {
+	check := connectivityCheck{Name: "ping", Loss: 100}
+	if m := pingLossRegexp.FindStringSubmatch(out); m != nil {
+		check.Transmitted, _ = strconv.Atoi(m[1])
+		check.Received, _ = strconv.Atoi(m[2])
+		check.Loss, _ = strconv.ParseFloat(m[3], 64)
+	}
+	if m := pingRTTRegexp.FindStringSubmatch(out); m != nil {
+		check.MinRTT, _ = strconv.ParseFloat(m[1], 64)
+		check.AvgRTT, _ = strconv.ParseFloat(m[2], 64)
+		check.MaxRTT, _ = strconv.ParseFloat(m[3], 64)
+	}
+	// ping exits with an error when packets are lost, the loss decides
+	// whether the check passes then
+	if err != nil && check.Transmitted == 0 {
+		check.Error = err.Error()
+		return check
+	}
+	check.Passed = check.Received > 0 && check.Loss <= maxLoss
+	return check
+}
+
+// iperfCheck returns the result of the iperf check from the JSON output
+// of iperf3
+func iperfCheck(out string, err error) connectivityCheck {
+	check := connectivityCheck{Name: "iperf"}
+	bandwidth, perr := parseIperf(out)
+	if perr != nil {
+		if err == nil {
+			err = perr
+		}
+		check.Error = err.Error()
+		return check
+	}
+	check.Bandwidth = bandwidth
+	check.Passed = check.Bandwidth > 0
+	return check
+}
+
+// parseIperf returns the bandwidth received by the iperf3 server in bits
+// per second from the JSON output of the iperf3 client
+func parseIperf(out string) (float64, error) {
+	var result struct {
+		End struct {
+			SumReceived struct {
+				BitsPerSecond float64 `json:"bits_per_second"`
+			} `json:"sum_received"`
+		} `json:"end"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		return 0, err
+	}
+	if result.Error != "" {
+		return 0, fmt.Errorf("%s", result.Error)
+	}
+	return result.End.SumReceived.BitsPerSecond, nil
+}
+
+// streamConnectivityCheck streams the result of the connectivity check
+func (mesh *Mesh) streamConnectivityCheck(opID string, report *connectivityReport, check connectivityCheck) {
+	e := &meshes.EventsResponse{
+		OperationId:   opID,
+		Component:     internalconfig.ServerConfig["type"],
+		ComponentName: internalconfig.ServerConfig["name"],
+	}
+
+	details, err := json.Marshal(check)
+	if err != nil {
+		mesh.streamErr("Error while encoding connectivity check", e, ErrConnectivity(err))
+		return
+	}
+	result := "passed"
+	if !check.Passed {
+		result = "failed"
+	}
+	e.Summary = fmt.Sprintf("%s check from %s to %s %s", check.Name, report.Pod, report.Target, result)
+	e.Details = string(details)
+	mesh.StreamInfo(e)
+}
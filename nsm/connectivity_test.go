@@ -0,0 +1,199 @@
+package nsm
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNSEAddress(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes string
+		want   string
+	}{
+		{
+			name: "route to the NSE",
+			routes: `default via 10.244.0.1 dev eth0
+10.244.0.0/24 dev eth0 proto kernel scope link src 10.244.0.12
+172.16.1.100 dev nsm-1 scope link`,
+			want: "172.16.1.100",
+		},
+		{
+			name:   "host route to the NSE",
+			routes: "172.16.1.100/32 dev nsm-1 scope link",
+			want:   "172.16.1.100",
+		},
+		{
+			name:   "prefix route only",
+			routes: "172.16.0.0/16 dev nsm-1 scope link",
+			want:   "",
+		},
+		{
+			name:   "no NSM interface",
+			routes: "default via 10.244.0.1 dev eth0",
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nseAddress(tt.routes); got != tt.want {
+				t.Errorf("nseAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPingCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		err     error
+		maxLoss float64
+		want    connectivityCheck
+	}{
+		{
+			name: "all replies",
+			out: `--- 172.16.1.100 ping statistics ---
+5 packets transmitted, 5 received, 0% packet loss, time 4005ms
+rtt min/avg/max/mdev = 0.417/0.612/0.921/0.176 ms`,
+			want: connectivityCheck{Name: "ping", Passed: true, Transmitted: 5, Received: 5, Loss: 0, MinRTT: 0.417, AvgRTT: 0.612, MaxRTT: 0.921},
+		},
+		{
+			name: "loss above the maximum",
+			out: `5 packets transmitted, 3 received, 40% packet loss, time 4005ms
+rtt min/avg/max/mdev = 0.417/0.612/0.921/0.176 ms`,
+			err:     errors.New("command terminated with exit code 1"),
+			maxLoss: 20,
+			want:    connectivityCheck{Name: "ping", Passed: false, Transmitted: 5, Received: 3, Loss: 40, MinRTT: 0.417, AvgRTT: 0.612, MaxRTT: 0.921},
+		},
+		{
+			name: "loss within the maximum",
+			out: `5 packets transmitted, 4 received, 20% packet loss, time 4005ms
+rtt min/avg/max/mdev = 0.417/0.612/0.921/0.176 ms`,
+			err:     errors.New("command terminated with exit code 1"),
+			maxLoss: 20,
+			want:    connectivityCheck{Name: "ping", Passed: true, Transmitted: 5, Received: 4, Loss: 20, MinRTT: 0.417, AvgRTT: 0.612, MaxRTT: 0.921},
+		},
+		{
+			name: "busybox output",
+			out: `5 packets transmitted, 5 packets received, 0% packet loss
+round-trip min/avg/max = 0.101/0.150/0.200 ms`,
+			want: connectivityCheck{Name: "ping", Passed: true, Transmitted: 5, Received: 5, Loss: 0, MinRTT: 0.101, AvgRTT: 0.15, MaxRTT: 0.2},
+		},
+		{
+			name: "no reply",
+			out:  "5 packets transmitted, 0 received, 100% packet loss, time 4005ms",
+			err:  errors.New("command terminated with exit code 1"),
+			want: connectivityCheck{Name: "ping", Passed: false, Transmitted: 5, Received: 0, Loss: 100},
+		},
+		{
+			name: "ping failed",
+			err:  errors.New("ping: connect: Network is unreachable"),
+			want: connectivityCheck{Name: "ping", Passed: false, Loss: 100, Error: "ping: connect: Network is unreachable"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pingCheck(tt.out, tt.err, tt.maxLoss); got != tt.want {
+				t.Errorf("pingCheck() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIperf(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    float64
+		wantErr bool
+	}{
+		{
+			name: "bandwidth",
+			out:  `{"start": {}, "end": {"sum_sent": {"bits_per_second": 9.5e9}, "sum_received": {"bits_per_second": 9.4e9}}}`,
+			want: 9.4e9,
+		},
+		{
+			name:    "iperf error",
+			out:     `{"start": {}, "end": {}, "error": "unable to connect to server: Connection refused"}`,
+			wantErr: true,
+		},
+		{
+			name:    "not JSON",
+			out:     "iperf3: error - unable to connect to server",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIperf(tt.out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIperf() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseIperf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckContainer(t *testing.T) {
+	const image = "nicolaka/netshoot:v0.11"
+	container := func(name, image string) corev1.EphemeralContainer {
+		return corev1.EphemeralContainer{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: name, Image: image}}
+	}
+	running := func(name string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: name, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}
+	}
+	terminated := func(name string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: name, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}}
+	}
+
+	tests := []struct {
+		name       string
+		containers []corev1.EphemeralContainer
+		statuses   []corev1.ContainerStatus
+		want       string
+	}{
+		{
+			name: "no ephemeral container",
+			want: "",
+		},
+		{
+			name:       "running check container",
+			containers: []corev1.EphemeralContainer{container("debugger", image), container("nsm-conncheck-abcde", image)},
+			statuses:   []corev1.ContainerStatus{running("debugger"), running("nsm-conncheck-abcde")},
+			want:       "nsm-conncheck-abcde",
+		},
+		{
+			name:       "terminated check container",
+			containers: []corev1.EphemeralContainer{container("nsm-conncheck-abcde", image), container("nsm-conncheck-fghij", image)},
+			statuses:   []corev1.ContainerStatus{terminated("nsm-conncheck-abcde"), running("nsm-conncheck-fghij")},
+			want:       "nsm-conncheck-fghij",
+		},
+		{
+			name:       "check container of another image",
+			containers: []corev1.EphemeralContainer{container("nsm-conncheck-abcde", "busybox")},
+			statuses:   []corev1.ContainerStatus{running("nsm-conncheck-abcde")},
+			want:       "",
+		},
+		{
+			name:       "check container not started",
+			containers: []corev1.EphemeralContainer{container("nsm-conncheck-abcde", image)},
+			want:       "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				Spec:   corev1.PodSpec{EphemeralContainers: tt.containers},
+				Status: corev1.PodStatus{EphemeralContainerStatuses: tt.statuses},
+			}
+			if got := checkContainer(pod, image); got != tt.want {
+				t.Errorf("checkContainer() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,23 @@
 package nsm
 
 import (
+	"context"
+
 	"github.com/layer5io/meshery-adapter-library/status"
 )
 
-func (mesh *Mesh) applyCustomOperation(namespace string, manifest string, isDel bool, kubeconfigs []string) (string, error) {
+func (mesh *Mesh) applyCustomOperation(ctx context.Context, namespace string, manifest string, kustomization *kustomizeOptions, isDel bool, kubeconfigs []string) (string, error) {
 	st := status.Starting
 
-	err := mesh.applyManifest([]byte(manifest), isDel, namespace, kubeconfigs)
+	if kustomization != nil {
+		var err error
+		manifest, err = buildKustomization(kustomization)
+		if err != nil {
+			return st, ErrCustomOperation(err)
+		}
+	}
+
+	err := mesh.applyManifest(ctx, []byte(manifest), isDel, namespace, kubeconfigs)
 	if err != nil {
 		return st, ErrCustomOperation(err)
 	}
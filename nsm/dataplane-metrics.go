@@ -0,0 +1,235 @@
+package nsm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/meshes"
+	internalconfig "github.com/layer5io/meshery-nsm/internal/config"
+	"github.com/layer5io/meshery-nsm/internal/metrics"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// prometheusPortAnnotation is the annotation of the pods declaring
+	// the port of their metrics
+	prometheusPortAnnotation = "prometheus.io/port"
+
+	// metricsPortName is the name of the container ports serving metrics
+	metricsPortName = "metrics"
+)
+
+// dataplaneComponents are the name prefixes of the pods of the NSM
+// components whose metrics are collected
+var dataplaneComponents = []string{"nsmgr", "forwarder"}
+
+// componentMetrics are the series collected from a pod of an NSM component
+type componentMetrics struct {
+	Pod       string             `json:"pod"`
+	Component string             `json:"component"`
+	Node      string             `json:"node,omitempty"`
+	Series    map[string]float64 `json:"series,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// clusterMetrics are the series collected from the NSM components of a
+// cluster, along with their totals across the components
+type clusterMetrics struct {
+	Components []componentMetrics `json:"components"`
+	Totals     map[string]float64 `json:"totals"`
+}
+
+// collectDataplaneMetrics scrapes the metrics of the NSM managers and
+// forwarders in the namespace of each of the clusters, keeping the series
+// matching the patterns. The collected series are also exposed through the
+// metrics endpoint of the adapter
+func (mesh *Mesh) collectDataplaneMetrics(ctx context.Context, namespace, port string, patterns []string, kubeconfigs []string) (map[string]*clusterMetrics, error) {
+	var wg sync.WaitGroup
+	var errs []error
+	var mx sync.Mutex
+	collected := make(map[string]*clusterMetrics)
+	for i, config := range kubeconfigs {
+		wg.Add(1)
+		go func(cluster, config string) {
+			defer wg.Done()
+			cm, err := mesh.collectClusterMetrics(ctx, kubeContextName(config, cluster), config, namespace, port, patterns)
+			mx.Lock()
+			defer mx.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			collected[cluster] = cm
+		}(clusterName(i), config)
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return collected, ErrCollectMetrics(namespace, mergeErrors(errs))
+	}
+	return collected, nil
+}
+
+// collectClusterMetrics scrapes the metrics of the NSM components of the
+// cluster through the API server. The pods which can not be scraped are
+// reported without failing the collection
+func (mesh *Mesh) collectClusterMetrics(ctx context.Context, cluster, config, namespace, port string, patterns []string) (*clusterMetrics, error) {
+	kClient, err := mesherykube.New([]byte(config))
+	if err != nil {
+		return nil, ErrCollectMetrics(cluster, err)
+	}
+	pods, err := kClient.KubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrCollectMetrics(cluster, err)
+	}
+
+	metrics.ResetDataplane(cluster)
+	cm := &clusterMetrics{Totals: make(map[string]float64)}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		component := dataplaneComponent(pod.Name)
+		if component == "" || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+
+		c := componentMetrics{Pod: pod.Name, Component: component, Node: pod.Spec.NodeName}
+		series, err := scrapePod(ctx, kClient, pod, port, patterns)
+		if err != nil {
+			err = ErrCollectMetrics(fmt.Sprintf("%s/%s", cluster, pod.Name), err)
+			mesh.Log.Warn(err)
+			c.Error = err.Error()
+		}
+		c.Series = series
+		for name, value := range series {
+			cm.Totals[name] += value
+			metrics.SetDataplane(cluster, pod.Name, component, name, value)
+		}
+		cm.Components = append(cm.Components, c)
+	}
+	return cm, nil
+}
+
+// dataplaneComponent returns the NSM component of the pod, empty if the
+// metrics of the pod are not collected
+func dataplaneComponent(pod string) string {
+	for _, c := range dataplaneComponents {
+		if strings.HasPrefix(pod, c) {
+			return c
+		}
+	}
+	return ""
+}
+
+// metricsPort returns the port the pod serves its metrics on, as declared
+// by its annotation or by the name of one of its container ports
+func metricsPort(pod *corev1.Pod, fallback string) string {
+	if port, ok := pod.Annotations[prometheusPortAnnotation]; ok {
+		return port
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.Name == metricsPortName {
+				return strconv.Itoa(int(p.ContainerPort))
+			}
+		}
+	}
+	return fallback
+}
+
+// scrapePod scrapes the metrics of the pod through the proxy of the API
+// server and returns the value of each of the series matching the patterns
+func scrapePod(ctx context.Context, kClient *mesherykube.Client, pod *corev1.Pod, port string, patterns []string) (map[string]float64, error) {
+	data, err := kClient.KubeClient.CoreV1().Pods(pod.Namespace).
+		ProxyGet("http", pod.Name, metricsPort(pod, port), "/metrics", nil).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	series := make(map[string]float64)
+	for name, family := range families {
+		if !matchesSeries(name, patterns) {
+			continue
+		}
+		series[name] = familyValue(family)
+	}
+	return series, nil
+}
+
+// matchesSeries returns true if the name of the series matches any of
+// the glob patterns
+func matchesSeries(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// familyValue returns the sum of the values of the metrics of the family
+// across their labels. The histograms and summaries are summed by their
+// number of observations
+func familyValue(family *dto.MetricFamily) float64 {
+	var sum float64
+	for _, m := range family.GetMetric() {
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			sum += m.GetCounter().GetValue()
+		case dto.MetricType_GAUGE:
+			sum += m.GetGauge().GetValue()
+		case dto.MetricType_HISTOGRAM:
+			sum += float64(m.GetHistogram().GetSampleCount())
+		case dto.MetricType_SUMMARY:
+			sum += float64(m.GetSummary().GetSampleCount())
+		default:
+			sum += m.GetUntyped().GetValue()
+		}
+	}
+	return sum
+}
+
+// streamDataplaneMetrics streams the metrics collected from each cluster
+// as an event
+func (mesh *Mesh) streamDataplaneMetrics(opID string, collected map[string]*clusterMetrics) {
+	clusters := make([]string, 0, len(collected))
+	for cluster := range collected {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+
+	for _, cluster := range clusters {
+		cm := collected[cluster]
+		e := &meshes.EventsResponse{
+			OperationId:   opID,
+			Component:     internalconfig.ServerConfig["type"],
+			ComponentName: internalconfig.ServerConfig["name"],
+		}
+
+		details, err := json.Marshal(cm)
+		if err != nil {
+			mesh.streamErr("Error while encoding NSM metrics", e, ErrCollectMetrics(cluster, err))
+			continue
+		}
+		e.Summary = fmt.Sprintf("%s: %d series collected from %d components", cluster, len(cm.Totals), len(cm.Components))
+		e.Details = string(details)
+		mesh.StreamInfo(e)
+	}
+}
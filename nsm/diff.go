@@ -0,0 +1,184 @@
+package nsm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/meshes"
+	internalconfig "github.com/layer5io/meshery-nsm/internal/config"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// driftAdded marks a live object of the release which is not desired
+	driftAdded = "added"
+	// driftChanged marks a live object which differs from the desired one
+	driftChanged = "changed"
+	// driftMissing marks a desired object which is not live
+	driftMissing = "missing"
+
+	// helmReleaseAnnotation is the annotation helm sets on the objects of a release
+	helmReleaseAnnotation = "meta.helm.sh/release-name"
+	// helmReleaseNamespaceAnnotation is the annotation helm sets on the
+	// objects of a release with the namespace of the release
+	helmReleaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+	// helmManagedSelector selects the objects managed by helm
+	helmManagedSelector = "app.kubernetes.io/managed-by=Helm"
+)
+
+// driftEntry is a difference between the desired and the live state of a cluster
+type driftEntry struct {
+	Cluster string   `json:"cluster"`
+	State   string   `json:"state"`
+	Object  string   `json:"object"`
+	Fields  []string `json:"fields,omitempty"`
+
+	// live is the live object of an added entry
+	live *unstructured.Unstructured
+}
+
+// diffNSM compares the live NSM objects on each of the clusters with the
+// desired ones, rendered from the version and values recorded in the NSM
+// release, and returns the differences keyed by the cluster name
+func (mesh *Mesh) diffNSM(ctx context.Context, namespace string, kubeconfigs []string) (map[string][]driftEntry, error) {
+	var wg sync.WaitGroup
+	var errs []error
+	var mx sync.Mutex
+	drift := make(map[string][]driftEntry)
+	for i, config := range kubeconfigs {
+		wg.Add(1)
+		go func(cluster, config string) {
+			defer wg.Done()
+			entries, err := diffReleaseOnCluster(ctx, cluster, config, internalconfig.NSMChart, namespace, mesh.images)
+
+			mx.Lock()
+			defer mx.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s", cluster, err))
+				return
+			}
+			drift[cluster] = entries
+		}(clusterName(i), config)
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return drift, ErrDiff(mergeErrors(errs))
+	}
+	return drift, nil
+}
+
+// diffReleaseOnCluster renders the release for its recorded chart version
+// and values and compares the result with the live objects on the cluster
+func diffReleaseOnCluster(ctx context.Context, cluster, config, name, namespace string, images *imageRewriter) ([]driftEntry, error) {
+	kClient, err := mesherykube.New([]byte(config))
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := desiredReleaseObjects(kClient, name, namespace, images)
+	if err != nil {
+		return nil, err
+	}
+	return diffManifest(ctx, kClient, cluster, objects, name, namespace)
+}
+
+// desiredReleaseObjects returns the objects of the release rendered for
+// its recorded chart version and values, with the images rewritten
+func desiredReleaseObjects(kClient *mesherykube.Client, name, namespace string, images *imageRewriter) ([]*unstructured.Unstructured, error) {
+	rel, err := getHelmRelease(kClient, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := renderHelmChart(rel.Chart.Name(), rel.Chart.Metadata.Version, namespace, rel.Config, images.postRenderer())
+	if err != nil {
+		return nil, err
+	}
+	return decodeManifest([]byte(manifest))
+}
+
+// diffManifest compares the desired objects with the live objects on the
+// cluster. The live objects of the release which are of the same kinds as
+// the desired ones but are not desired are reported as added
+func diffManifest(ctx context.Context, kClient *mesherykube.Client, cluster string, objects []*unstructured.Unstructured, release, namespace string) ([]driftEntry, error) {
+	mapper := newRESTMapper(kClient)
+	desired := make(map[string]struct{})
+	resources := make(map[schema.GroupVersionKind]dynamic.ResourceInterface)
+	var entries []driftEntry
+	for _, obj := range objects {
+		ri, err := resourceFor(kClient, mapper, obj, namespace)
+		if err != nil {
+			return nil, err
+		}
+		ref := objectRef(obj)
+		desired[ref] = struct{}{}
+		resources[obj.GroupVersionKind()] = ri
+
+		live, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if kubeerror.IsNotFound(err) {
+			entries = append(entries, driftEntry{Cluster: cluster, State: driftMissing, Object: ref})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if fields := diffDesiredFields(live.Object, obj.Object); len(fields) != 0 {
+			entries = append(entries, driftEntry{Cluster: cluster, State: driftChanged, Object: ref, Fields: fields})
+		}
+	}
+
+	for _, ri := range resources {
+		list, err := ri.List(ctx, metav1.ListOptions{LabelSelector: helmManagedSelector})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			item := &list.Items[i]
+			annotations := item.GetAnnotations()
+			if annotations[helmReleaseAnnotation] != release || annotations[helmReleaseNamespaceAnnotation] != namespace {
+				continue
+			}
+			if _, ok := desired[objectRef(item)]; !ok {
+				entries = append(entries, driftEntry{Cluster: cluster, State: driftAdded, Object: objectRef(item), live: item})
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// streamDrift streams the differences found on each of the clusters as an event
+// per cluster, with the differences encoded as JSON in the details
+func (mesh *Mesh) streamDrift(opID string, drift map[string][]driftEntry) {
+	clusters := make([]string, 0, len(drift))
+	for cluster := range drift {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+
+	for _, cluster := range clusters {
+		entries := drift[cluster]
+		e := &meshes.EventsResponse{
+			OperationId:   opID,
+			Component:     internalconfig.ServerConfig["type"],
+			ComponentName: internalconfig.ServerConfig["name"],
+		}
+
+		details, err := json.Marshal(entries)
+		if err != nil {
+			mesh.streamErr("Error while encoding NSM diff", e, ErrDiff(err))
+			continue
+		}
+		e.Summary = fmt.Sprintf("%s: %d differences found", cluster, len(entries))
+		e.Details = string(details)
+		mesh.StreamInfo(e)
+	}
+}
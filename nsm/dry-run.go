@@ -0,0 +1,146 @@
+package nsm
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// plannedCreate marks an object which would be created
+	plannedCreate = "create"
+	// plannedConfigure marks an object which would be changed
+	plannedConfigure = "configure"
+	// plannedUnchanged marks an object which already matches the manifest
+	plannedUnchanged = "unchanged"
+	// plannedDelete marks an object which would be deleted
+	plannedDelete = "delete"
+	// plannedRun marks an action other than an object change which would be run
+	plannedRun = "run"
+)
+
+// plannedChange is a change a dry-run operation would have made to a cluster
+type plannedChange struct {
+	Cluster string `json:"cluster"`
+	Action  string `json:"action"`
+	Object  string `json:"object"`
+	// Fields are the paths of the fields which would change
+	Fields []string `json:"fields,omitempty"`
+	// Error is the reason the server-side dry-run rejected the change
+	Error string `json:"error,omitempty"`
+}
+
+// dryRunReport collects the changes planned by a dry-run operation
+type dryRunReport struct {
+	mx      sync.Mutex
+	Changes []plannedChange `json:"changes"`
+}
+
+type dryRunKey struct{}
+
+// withDryRun returns a context which marks the operation as a dry-run
+// along with the report collecting the planned changes
+func withDryRun(ctx context.Context) (context.Context, *dryRunReport) {
+	report := &dryRunReport{}
+	return context.WithValue(ctx, dryRunKey{}, report), report
+}
+
+// dryRunFrom returns the report of the dry-run operation, nil if the
+// operation is not a dry-run
+func dryRunFrom(ctx context.Context) *dryRunReport {
+	report, _ := ctx.Value(dryRunKey{}).(*dryRunReport)
+	return report
+}
+
+// record adds the changes to the report
+func (r *dryRunReport) record(changes ...plannedChange) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.Changes = append(r.Changes, changes...)
+}
+
+// json returns the report encoded as JSON
+func (r *dryRunReport) json() (string, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	out, err := json.Marshal(r)
+	if err != nil {
+		return "", ErrDryRun(err)
+	}
+	return string(out), nil
+}
+
+// dryRunManifest runs a server-side dry-run of applying or deleting the
+// manifest and returns the changes it would make. Objects rejected by the
+// server are reported along with the reason instead of failing the dry-run
+func dryRunManifest(ctx context.Context, kClient *mesherykube.Client, cluster string, contents []byte, isDel bool, namespace string) ([]plannedChange, error) {
+	objects, err := decodeManifest(contents)
+	if err != nil {
+		return nil, err
+	}
+	sortObjects(objects, isDel)
+
+	dryRun := []string{metav1.DryRunAll}
+	mapper := newRESTMapper(kClient)
+	changes := make([]plannedChange, 0, len(objects))
+	for _, obj := range objects {
+		change := plannedChange{Cluster: cluster}
+
+		ri, err := resourceFor(kClient, mapper, obj, namespace)
+		change.Object = objectRef(obj)
+		if err != nil {
+			change.Action = plannedCreate
+			if isDel {
+				change.Action = plannedDelete
+			}
+			change.Error = err.Error()
+			changes = append(changes, change)
+			continue
+		}
+
+		live, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		switch {
+		case err != nil && !kubeerror.IsNotFound(err):
+			change.Action = plannedConfigure
+			change.Error = err.Error()
+		case isDel && err != nil:
+			// Nothing to delete
+			continue
+		case isDel:
+			change.Action = plannedDelete
+			if err := ri.Delete(ctx, obj.GetName(), metav1.DeleteOptions{DryRun: dryRun}); err != nil {
+				change.Error = err.Error()
+			}
+		case err != nil:
+			change.Action = plannedCreate
+			if _, err := ri.Create(ctx, obj, metav1.CreateOptions{DryRun: dryRun}); err != nil {
+				change.Error = err.Error()
+			}
+		default:
+			result, err := ri.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+				DryRun:       dryRun,
+				FieldManager: manifestApplyFrom(ctx).manager(),
+				Force:        manifestApplyFrom(ctx).ForceConflicts,
+			})
+			if err != nil {
+				change.Action = plannedConfigure
+				change.Error = err.Error()
+				if conflicts := fieldConflicts(err); len(conflicts) != 0 {
+					change.Error = ErrFieldConflict(cluster, change.Object, conflicts).Error()
+				}
+				break
+			}
+			change.Fields = diffObjects(live.Object, result.Object)
+			change.Action = plannedUnchanged
+			if len(change.Fields) != 0 {
+				change.Action = plannedConfigure
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
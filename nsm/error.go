@@ -1,6 +1,9 @@
 package nsm
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/layer5io/meshkit/errors"
 )
 
@@ -58,6 +61,134 @@ var (
 	// ErrLoadNamespaceCode implies error while finding namespace
 	ErrLoadNamespaceCode = "1015"
 
+	// ErrPreflightCode represents the errors which are generated
+	// while running the pre-flight checks
+	ErrPreflightCode = "1016"
+
+	// ErrPreflightFailedCode represents the error which is generated
+	// when one or more pre-flight checks fail
+	ErrPreflightFailedCode = "1017"
+
+	// ErrParseOperationOptionsCode represents the error which is generated
+	// when the options in the custom body of a request are invalid
+	ErrParseOperationOptionsCode = "1018"
+
+	// ErrInvalidForwarderCode represents the error which is generated
+	// when an unknown forwarder is requested
+	ErrInvalidForwarderCode = "1019"
+
+	// ErrDiscoverForwardersCode represents the errors which are generated
+	// while discovering the running forwarders
+	ErrDiscoverForwardersCode = "1020"
+
+	// ErrExecInPodCode represents the errors which are generated
+	// while executing a command in a pod
+	ErrExecInPodCode = "1021"
+
+	// ErrFindPodCode represents the errors which are generated
+	// when no running pod matches a selector
+	ErrFindPodCode = "1022"
+
+	// ErrInterdomainCode represents the errors which are generated
+	// while setting up the interdomain topology
+	ErrInterdomainCode = "1023"
+
+	// ErrInterdomainClustersCode represents the error which is generated
+	// when too few clusters are passed for an interdomain topology
+	ErrInterdomainClustersCode = "1024"
+
+	// ErrFloatingRegistryCode represents the errors which are generated
+	// while setting up the floating interdomain registry
+	ErrFloatingRegistryCode = "1025"
+
+	// ErrInvalidFloatingClusterCode represents the error which is generated
+	// when the floating registry cluster is not one of the passed clusters
+	ErrInvalidFloatingClusterCode = "1026"
+
+	// ErrVL3NetworkCode represents the errors which are generated
+	// while deploying a vL3 network
+	ErrVL3NetworkCode = "1027"
+
+	// ErrMeshIntegrationCode represents the errors which are generated
+	// while integrating NSM with a service mesh
+	ErrMeshIntegrationCode = "1028"
+
+	// ErrRenderHelmChartCode represents the errors which are generated
+	// while rendering a helm chart
+	ErrRenderHelmChartCode = "1029"
+
+	// ErrDryRunCode represents the errors which are generated
+	// while reporting the changes planned by a dry-run operation
+	ErrDryRunCode = "1030"
+
+	// ErrGetHelmReleaseCode represents the errors which are generated
+	// while fetching a helm release from a cluster
+	ErrGetHelmReleaseCode = "1031"
+
+	// ErrDiffCode represents the errors which are generated
+	// while comparing the desired and the live state of the clusters
+	ErrDiffCode = "1032"
+
+	// ErrReconcileCode represents the errors which are generated
+	// while reconciling the drift of the clusters
+	ErrReconcileCode = "1033"
+
+	// ErrInvalidIgnoreRuleCode represents the errors which are generated
+	// when a drift ignore rule is malformed
+	ErrInvalidIgnoreRuleCode = "1034"
+
+	// ErrJournalCode represents the errors which are generated
+	// while reading or writing the operation journal
+	ErrJournalCode = "1035"
+
+	// ErrApplyObjectCode represents the errors which are generated
+	// when an object of a strictly applied manifest fails
+	ErrApplyObjectCode = "1036"
+
+	// ErrRollbackCode represents the errors which are generated
+	// while rolling back the objects of a failed manifest
+	ErrRollbackCode = "1037"
+
+	// ErrFieldConflictCode represents the errors which are generated when
+	// the fields of an applied object are managed by another field manager
+	ErrFieldConflictCode = "1038"
+
+	// ErrKustomizeCode represents the errors which are generated
+	// while building a kustomization
+	ErrKustomizeCode = "1039"
+
+	// ErrRenderManifestCode represents the errors which are generated
+	// while rendering a manifest template
+	ErrRenderManifestCode = "1040"
+
+	// ErrRewriteImageCode represents the errors which are generated
+	// while rewriting the image references of charts and manifests
+	ErrRewriteImageCode = "1041"
+
+	// ErrCollectMetricsCode represents the errors which are generated
+	// while collecting the metrics of the NSM components
+	ErrCollectMetricsCode = "1042"
+
+	// ErrAddonCode represents the errors which are generated
+	// while deploying the observability add-ons
+	ErrAddonCode = "1043"
+
+	// ErrInspectTopologyCode represents the errors which are generated
+	// while inspecting the topology of the network service connections
+	ErrInspectTopologyCode = "1044"
+
+	// ErrConnectivityCode represents the errors which are generated
+	// while testing the connectivity of a client to its endpoint
+	ErrConnectivityCode = "1045"
+
+	// ErrBenchmarkCode represents the errors which are generated
+	// while benchmarking the datapaths
+	ErrBenchmarkCode = "1046"
+
+	// ErrHealCode represents the errors which are generated
+	// while verifying the healing of a connection
+	ErrHealCode = "1047"
+
 	// ErrOpInvalid represents the errors which are generated
 	// when an invalid operation is requested
 	ErrOpInvalid = errors.New(ErrOpInvalidCode, errors.Alert, []string{"Invalid operation"}, []string{}, []string{}, []string{})
@@ -122,3 +253,165 @@ func ErrCustomOperation(err error) error {
 func ErrLoadNamespace(err error, str string) error {
 	return errors.New(ErrLoadNamespaceCode, errors.Alert, []string{"Error while labeling namespace:", str}, []string{err.Error()}, []string{}, []string{})
 }
+
+// ErrPreflight is the error for running the pre-flight checks
+func ErrPreflight(err error) error {
+	return errors.New(ErrPreflightCode, errors.Alert, []string{"Error while running pre-flight checks"}, []string{err.Error()}, []string{}, []string{})
+}
+
+// ErrPreflightFailed is the error when one or more pre-flight checks fail
+func ErrPreflightFailed(failures []string) error {
+	return errors.New(ErrPreflightFailedCode, errors.Alert, []string{"Pre-flight checks failed"}, failures, []string{"The cluster does not satisfy the requirements for installing NSM"}, []string{"Resolve the failed checks listed in the pre-flight report and retry"})
+}
+
+// ErrParseOperationOptions is the error for parsing the operation options
+func ErrParseOperationOptions(err error) error {
+	return errors.New(ErrParseOperationOptionsCode, errors.Alert, []string{"Error parsing operation options"}, []string{err.Error()}, []string{"The custom body of the request is not valid YAML or JSON"}, []string{"Pass the operation options as a YAML or JSON object"})
+}
+
+// ErrInvalidForwarder is the error when an unknown forwarder is requested
+func ErrInvalidForwarder(name string) error {
+	return errors.New(ErrInvalidForwarderCode, errors.Alert, []string{"Invalid forwarder"}, []string{fmt.Sprintf("unknown forwarder %s", name)}, []string{}, []string{"Use one of the forwarders listed in the operation properties"})
+}
+
+// ErrDiscoverForwarders is the error for discovering the running forwarders
+func ErrDiscoverForwarders(err error) error {
+	return errors.New(ErrDiscoverForwardersCode, errors.Alert, []string{"Error discovering forwarders"}, []string{err.Error()}, []string{}, []string{})
+}
+
+// ErrExecInPod is the error for executing a command in a pod
+func ErrExecInPod(pod string, err error) error {
+	return errors.New(ErrExecInPodCode, errors.Alert, []string{"Error executing command in pod"}, []string{fmt.Sprintf("%s: %s", pod, err)}, []string{}, []string{})
+}
+
+// ErrFindPod is the error when no running pod matches the selector
+func ErrFindPod(selector string, err error) error {
+	return errors.New(ErrFindPodCode, errors.Alert, []string{"Unable to find a running pod"}, []string{fmt.Sprintf("selector %s: %s", selector, err)}, []string{}, []string{})
+}
+
+// ErrInterdomain is the error for setting up the interdomain topology
+func ErrInterdomain(err error) error {
+	return errors.New(ErrInterdomainCode, errors.Alert, []string{"Error with interdomain operation"}, []string{err.Error()}, []string{}, []string{})
+}
+
+// ErrInterdomainClusters is the error when too few clusters are passed for an interdomain topology
+func ErrInterdomainClusters(count int) error {
+	return errors.New(ErrInterdomainClustersCode, errors.Alert, []string{"Interdomain topology requires at least 2 clusters"}, []string{fmt.Sprintf("Interdomain topology requires at least 2 clusters, got %d", count)}, []string{}, []string{"Select at least two kubernetes contexts for the operation"})
+}
+
+// ErrFloatingRegistry is the error for setting up the floating interdomain registry
+func ErrFloatingRegistry(err error) error {
+	return errors.New(ErrFloatingRegistryCode, errors.Alert, []string{"Error with floating registry operation"}, []string{err.Error()}, []string{}, []string{})
+}
+
+// ErrInvalidFloatingCluster is the error when the floating registry cluster is out of range
+func ErrInvalidFloatingCluster(index, count int) error {
+	return errors.New(ErrInvalidFloatingClusterCode, errors.Alert, []string{"Invalid floating registry cluster"}, []string{fmt.Sprintf("Invalid floating registry cluster %d, expected a value between 0 and %d", index, count-1)}, []string{}, []string{"Set floatingCluster to the index of one of the selected kubernetes contexts"})
+}
+
+// ErrVL3Network is the error for deploying a vL3 network
+func ErrVL3Network(err error) error {
+	return errors.New(ErrVL3NetworkCode, errors.Alert, []string{"Error with vL3 network operation"}, []string{err.Error()}, []string{}, []string{})
+}
+
+// ErrMeshIntegration is the error for integrating NSM with a service mesh
+func ErrMeshIntegration(err error) error {
+	return errors.New(ErrMeshIntegrationCode, errors.Alert, []string{"Error with service mesh integration operation"}, []string{err.Error()}, []string{}, []string{})
+}
+
+// ErrRenderHelmChart is the error for rendering a helm chart
+func ErrRenderHelmChart(chart string, err error) error {
+	return errors.New(ErrRenderHelmChartCode, errors.Alert, []string{"Error rendering helm chart"}, []string{fmt.Sprintf("%s: %s", chart, err)}, []string{}, []string{})
+}
+
+// ErrDryRun is the error for reporting the changes planned by a dry-run operation
+func ErrDryRun(err error) error {
+	return errors.New(ErrDryRunCode, errors.Alert, []string{"Error with dry-run operation"}, []string{err.Error()}, []string{}, []string{})
+}
+
+// ErrGetHelmRelease is the error for fetching a helm release from a cluster
+func ErrGetHelmRelease(name string, err error) error {
+	return errors.New(ErrGetHelmReleaseCode, errors.Alert, []string{"Error fetching helm release"}, []string{fmt.Sprintf("%s: %s", name, err)}, []string{"The release is not installed in the namespace"}, []string{"Install NSM in the namespace before comparing its state"})
+}
+
+// ErrDiff is the error for comparing the desired and the live state of the clusters
+func ErrDiff(err error) error {
+	return errors.New(ErrDiffCode, errors.Alert, []string{"Error with diff operation"}, []string{err.Error()}, []string{}, []string{})
+}
+
+// ErrReconcile is the error for reconciling the drift of the clusters
+func ErrReconcile(err error) error {
+	return errors.New(ErrReconcileCode, errors.Alert, []string{"Error with drift reconciliation"}, []string{err.Error()}, []string{}, []string{})
+}
+
+// ErrInvalidIgnoreRule is the error for a malformed drift ignore rule
+func ErrInvalidIgnoreRule(rule string, err error) error {
+	return errors.New(ErrInvalidIgnoreRuleCode, errors.Alert, []string{"Invalid drift ignore rule"}, []string{fmt.Sprintf("%s: %s", rule, err)}, []string{"The rule is not a valid glob pattern"}, []string{"Use rules of the form <kind>/<namespace>/<name>[:<field>]"})
+}
+
+// ErrJournal is the error for reading or writing the operation journal
+func ErrJournal(err error) error {
+	return errors.New(ErrJournalCode, errors.Alert, []string{"Error with operation journal"}, []string{err.Error()}, []string{"The journal file is locked by another adapter instance or is corrupted"}, []string{"Make sure a single adapter instance uses the config directory"})
+}
+
+// ErrApplyObject is the error for an object of a strictly applied manifest
+// which failed, ref identifies the kind, namespace and name of the object
+func ErrApplyObject(cluster, ref string, err error) error {
+	return errors.New(ErrApplyObjectCode, errors.Alert, []string{"Error applying object"}, []string{fmt.Sprintf("%s on %s: %s", ref, cluster, err)}, []string{"The object is invalid or is rejected by the cluster"}, []string{"Fix the object, the objects preceding it in the manifest were applied"})
+}
+
+// ErrRollback is the error for rolling back the objects of a failed manifest
+func ErrRollback(cluster string, err error) error {
+	return errors.New(ErrRollbackCode, errors.Alert, []string{"Error rolling back the manifest"}, []string{fmt.Sprintf("%s: %s", cluster, err)}, []string{}, []string{"Delete the remaining objects of the manifest manually"})
+}
+
+// ErrFieldConflict is the error for an applied object whose fields are
+// managed by other field managers, conflicts describe each of the fields
+func ErrFieldConflict(cluster, ref string, conflicts []string) error {
+	return errors.New(ErrFieldConflictCode, errors.Alert, []string{"Field conflicts applying object"}, []string{fmt.Sprintf("%s on %s: %s", ref, cluster, strings.Join(conflicts, "; "))}, []string{"The fields are managed by another controller or client"}, []string{"Apply the operation with forceConflicts to take over the fields"})
+}
+
+// ErrKustomize is the error for building a kustomization
+func ErrKustomize(err error) error {
+	return errors.New(ErrKustomizeCode, errors.Alert, []string{"Error building kustomization"}, []string{err.Error()}, []string{"The kustomization or one of its files is invalid"}, []string{"Build the kustomization locally with kustomize build to find the issue"})
+}
+
+// ErrRenderManifest is the error for rendering a manifest template
+func ErrRenderManifest(err error) error {
+	return errors.New(ErrRenderManifestCode, errors.Alert, []string{"Error rendering manifest template"}, []string{err.Error()}, []string{"The manifest is not a valid Go template or references an unknown variable or parameter"}, []string{"Pass the parameters referenced by the manifest, literal braces are written as {{\"{{\"}}"})
+}
+
+// ErrRewriteImage is the error for rewriting an image reference
+func ErrRewriteImage(image string, err error) error {
+	return errors.New(ErrRewriteImageCode, errors.Alert, []string{"Error rewriting image reference"}, []string{fmt.Sprintf("%s: %s", image, err)}, []string{"The image reference is invalid or its digest can not be resolved from the mirror"}, []string{"Make sure the image is pushed to the registry mirror"})
+}
+
+// ErrCollectMetrics is the error for collecting the metrics of the NSM components
+func ErrCollectMetrics(target string, err error) error {
+	return errors.New(ErrCollectMetricsCode, errors.Alert, []string{"Error collecting NSM metrics"}, []string{fmt.Sprintf("%s: %s", target, err)}, []string{"The metrics of the NSM components are disabled or served on another port"}, []string{"Enable the Prometheus metrics of the NSM components and pass their port with the metricsPort option"})
+}
+
+// ErrAddon is the error for deploying an observability add-on
+func ErrAddon(err error) error {
+	return errors.New(ErrAddonCode, errors.Alert, []string{"Error deploying add-on"}, []string{err.Error()}, []string{}, []string{})
+}
+
+// ErrInspectTopology is the error for inspecting the topology of the network service connections
+func ErrInspectTopology(err error) error {
+	return errors.New(ErrInspectTopologyCode, errors.Alert, []string{"Error inspecting connection topology"}, []string{err.Error()}, []string{}, []string{})
+}
+
+// ErrConnectivity is the error for testing the connectivity of a client to its endpoint
+func ErrConnectivity(err error) error {
+	return errors.New(ErrConnectivityCode, errors.Alert, []string{"Error testing connectivity"}, []string{err.Error()}, []string{"The client pod is not connected to a network service or its checks failed"}, []string{"Inspect the connection topology with the nsm-inspect operation and check the logs of the forwarders"})
+}
+
+// ErrBenchmark is the error for benchmarking the datapaths
+func ErrBenchmark(err error) error {
+	return errors.New(ErrBenchmarkCode, errors.Alert, []string{"Error benchmarking datapaths"}, []string{err.Error()}, []string{"The benchmark client did not connect to its NSE or the forwarder does not support the datapath"}, []string{"Run the connectivity test of the benchmark client and benchmark the datapaths supported by the installed forwarder only"})
+}
+
+// ErrHeal is the error for verifying the healing of a connection
+func ErrHeal(err error) error {
+	return errors.New(ErrHealCode, errors.Alert, []string{"Error verifying connection healing"}, []string{err.Error()}, []string{"The test connection did not come up or did not recover from an injected fault"}, []string{"Check the logs of the NSM managers and forwarders for the failed heal"})
+}
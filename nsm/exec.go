@@ -0,0 +1,67 @@
+package nsm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// execInPod runs the command in the container of the pod and returns its
+// standard output. The standard error is returned as part of the error
+// if the command fails
+func execInPod(kClient *mesherykube.Client, namespace, pod, container string, command []string, stdin io.Reader) (string, error) {
+	req := kClient.KubeClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod).
+		Namespace(namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	restConfig := kClient.RestConfig
+	executor, err := remotecommand.NewSPDYExecutor(&restConfig, "POST", req.URL())
+	if err != nil {
+		return "", ErrExecInPod(pod, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = executor.StreamWithContext(context.TODO(), remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return stdout.String(), ErrExecInPod(pod, fmt.Errorf("%s: %s", err, stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// findRunningPod returns the name of the first running pod in the namespace
+// matching the label selector
+func findRunningPod(kClient *mesherykube.Client, namespace, selector string) (string, error) {
+	pods, err := kClient.KubeClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return "", ErrFindPod(selector, err)
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			return pod.Name, nil
+		}
+	}
+	return "", ErrFindPod(selector, fmt.Errorf("no running pod found in namespace %s", namespace))
+}
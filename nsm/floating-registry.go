@@ -0,0 +1,93 @@
+package nsm
+
+import (
+	"context"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	internalconfig "github.com/layer5io/meshery-nsm/internal/config"
+)
+
+// installFloatingRegistry deploys the floating registry on the designated cluster
+// of the interdomain topology and points the registry proxies of the remaining
+// clusters at it. The delete operation reverses the wiring and removes the
+// floating registry
+func (mesh *Mesh) installFloatingRegistry(ctx context.Context, del bool, version, namespace, forwarder string, floating int, kubeconfigs []string) (string, error) {
+	st := status.Installing
+	if del {
+		st = status.Removing
+	}
+
+	if len(kubeconfigs) < 2 {
+		return st, ErrInterdomainClusters(len(kubeconfigs))
+	}
+	if floating < 0 || floating >= len(kubeconfigs) {
+		return st, ErrInvalidFloatingCluster(floating, len(kubeconfigs))
+	}
+
+	_, profile, err := getForwarderProfile(forwarder)
+	if err != nil {
+		return st, err
+	}
+
+	clusters, err := newInterdomainClusters(kubeconfigs)
+	if err != nil {
+		return st, ErrFloatingRegistry(err)
+	}
+	registry := clusters[floating]
+	members := federatedDomains(clusters, registry)
+
+	if !del {
+		values := map[string]interface{}{
+			"domain": registry.Domain,
+			"spire": map[string]interface{}{
+				"trustDomain":   registry.Domain,
+				"federatesWith": members,
+			},
+		}
+		err := mesh.applyRecordedHelmChart(ctx, registry.Name, registry.Config, internalconfig.NSMFloatingRegistryChart, version, namespace, values, false)
+		if err != nil {
+			return st, ErrApplyHelmChart(err)
+		}
+	}
+
+	// The registry proxies are reconfigured by upgrading the NSM release
+	// of each of the remaining clusters, as the upgrade does not reuse
+	// the previous values the whole interdomain values are passed again
+	err = forEachCluster(clusters, func(c *interdomainCluster) error {
+		if c == registry {
+			return nil
+		}
+		values := interdomainValues(profile, c.Domain, federatedDomains(clusters, c))
+		if !del {
+			setFloatingDomain(values, registry.Domain)
+		}
+		return mesh.applyRecordedHelmChart(ctx, c.Name, c.Config, internalconfig.NSMChart, version, namespace, values, false)
+	})
+	if err != nil {
+		return st, ErrFloatingRegistry(err)
+	}
+
+	if del {
+		err := mesh.applyRecordedHelmChart(ctx, registry.Name, registry.Config, internalconfig.NSMFloatingRegistryChart, version, namespace, nil, true)
+		if err != nil {
+			return st, ErrApplyHelmChart(err)
+		}
+		return status.Removed, nil
+	}
+
+	return status.Installed, nil
+}
+
+// setFloatingDomain points the registry proxy of the interdomain values
+// at the floating registry domain
+func setFloatingDomain(values map[string]interface{}, domain string) {
+	interdomain, ok := values["interdomain"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	proxy, ok := interdomain["registryProxy"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	proxy["floatingDomain"] = domain
+}
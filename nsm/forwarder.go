@@ -0,0 +1,195 @@
+package nsm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	internalconfig "github.com/layer5io/meshery-nsm/internal/config"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// forwarderProfile describes how a forwarder is installed and what it
+// requires from the nodes it runs on
+type forwarderProfile struct {
+	// Values are the chart values which select the forwarder
+	Values map[string]interface{}
+	// Keyword identifies the forwarder daemonset by its name
+	Keyword string
+	// CheckNodes verifies the node prerequisites of the forwarder
+	CheckNodes func(*mesherykube.Client) (string, string)
+}
+
+// forwarderProfiles maps the forwarder names to their profiles. There is
+// no SR-IOV profile since the forwardingPlane value of the NSM chart only
+// selects the VPP and the kernel forwarders
+var forwarderProfiles = map[string]forwarderProfile{
+	internalconfig.ForwarderVPP: {
+		Values:     map[string]interface{}{"forwardingPlane": "vpp"},
+		Keyword:    "vpp",
+		CheckNodes: checkVPPNodeRequirements,
+	},
+	internalconfig.ForwarderKernel: {
+		Values:     map[string]interface{}{"forwardingPlane": "kernel"},
+		Keyword:    "kernel",
+		CheckNodes: checkKernelNodeRequirements,
+	},
+}
+
+const (
+	// vppMinKernelVersion is the minimum node kernel version for the VPP forwarder
+	vppMinKernelVersion = "4.4.0"
+
+	// kernelMinKernelVersion is the minimum node kernel version for the kernel forwarder
+	kernelMinKernelVersion = "4.4.0"
+)
+
+// getForwarderProfile returns the profile of the named forwarder, the
+// default forwarder is used if the name is empty
+func getForwarderProfile(name string) (string, forwarderProfile, error) {
+	if name == "" {
+		name = internalconfig.DefaultForwarder
+	}
+
+	profile, ok := forwarderProfiles[name]
+	if !ok {
+		return name, forwarderProfile{}, ErrInvalidForwarder(name)
+	}
+	return name, profile, nil
+}
+
+// checkVPPNodeRequirements verifies that the nodes satisfy the kernel and
+// hugepage requirements of the VPP forwarder
+func checkVPPNodeRequirements(kClient *mesherykube.Client) (string, string) {
+	return checkNodes(kClient, func(node corev1.Node) []string {
+		problems := checkNodeKernel(node, vppMinKernelVersion)
+		hugepages, ok := node.Status.Allocatable["hugepages-2Mi"]
+		if !ok || hugepages.IsZero() {
+			problems = append(problems, fmt.Sprintf("%s: no 2Mi hugepages allocatable", node.Name))
+		}
+		return problems
+	})
+}
+
+// checkKernelNodeRequirements verifies that the nodes satisfy the kernel
+// requirements of the kernel forwarder
+func checkKernelNodeRequirements(kClient *mesherykube.Client) (string, string) {
+	return checkNodes(kClient, func(node corev1.Node) []string {
+		return checkNodeKernel(node, kernelMinKernelVersion)
+	})
+}
+
+// checkNodes runs the check on each of the nodes, which returns the
+// problems of the node with the forwarder requirements
+func checkNodes(kClient *mesherykube.Client, check func(corev1.Node) []string) (string, string) {
+	nodes, err := kClient.KubeClient.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return preflightFailed, fmt.Sprintf("unable to list nodes: %s", err)
+	}
+
+	var problems []string
+	for _, node := range nodes.Items {
+		problems = append(problems, check(node)...)
+	}
+
+	if len(problems) != 0 {
+		return preflightWarning, strings.Join(problems, "; ")
+	}
+	return preflightPassed, fmt.Sprintf("all %d nodes satisfy the forwarder requirements", len(nodes.Items))
+}
+
+// checkNodeKernel returns the problem of the node if its kernel is older
+// than the minimum version
+func checkNodeKernel(node corev1.Node, minVersion string) []string {
+	kernel, err := version.ParseGeneric(node.Status.NodeInfo.KernelVersion)
+	if err != nil || kernel.LessThan(version.MustParseGeneric(minVersion)) {
+		return []string{fmt.Sprintf("%s: kernel %s is older than %s", node.Name, node.Status.NodeInfo.KernelVersion, minVersion)}
+	}
+	return nil
+}
+
+// discoverForwarders returns the forwarders running in the namespace of
+// each of the clusters, keyed by the cluster name
+func (mesh *Mesh) discoverForwarders(namespace string, kubeconfigs []string) (map[string][]string, error) {
+	var wg sync.WaitGroup
+	var errs []error
+	var mx sync.Mutex
+	found := make(map[string][]string)
+	for i, config := range kubeconfigs {
+		wg.Add(1)
+		go func(cluster, config string) {
+			defer wg.Done()
+			kClient, err := mesherykube.New([]byte(config))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			forwarders, err := clusterForwarders(kClient, namespace)
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			mx.Lock()
+			found[cluster] = forwarders
+			mx.Unlock()
+		}(clusterName(i), config)
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return found, ErrDiscoverForwarders(mergeErrors(errs))
+	}
+	return found, nil
+}
+
+// clusterForwarders returns the forwarders running in the namespace of the
+// cluster, in all of its namespaces when the namespace is empty
+func clusterForwarders(kClient *mesherykube.Client, namespace string) ([]string, error) {
+	daemonsets, err := kClient.KubeClient.AppsV1().DaemonSets(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var forwarders []string
+	for _, d := range daemonsets.Items {
+		if !strings.Contains(d.Name, "forwarder") && !strings.Contains(d.Name, "dataplane") {
+			continue
+		}
+		for name, profile := range forwarderProfiles {
+			if strings.Contains(d.Name, profile.Keyword) {
+				forwarders = append(forwarders, name)
+			}
+		}
+	}
+	sort.Strings(forwarders)
+	return forwarders, nil
+}
+
+// forwardersSummary formats the discovered forwarders of each cluster
+func forwardersSummary(forwarders map[string][]string) string {
+	clusters := make([]string, 0, len(forwarders))
+	for cluster := range forwarders {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+
+	var parts []string
+	for _, cluster := range clusters {
+		names := forwarders[cluster]
+		if len(names) == 0 {
+			names = []string{status.None}
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", cluster, strings.Join(names, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,338 @@
+package nsm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/meshes"
+	internalconfig "github.com/layer5io/meshery-nsm/internal/config"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// healConnection is the name of the test connection the faults are
+	// injected into
+	healConnection = "nsm-heal"
+
+	// healProbeInterval is the interval between the probes of the test
+	// connection while it heals
+	healProbeInterval = time.Second
+
+	// defaultHealTimeout is the time the test connection is given to heal
+	// from each fault
+	defaultHealTimeout = 3 * time.Minute
+)
+
+// fault describes a failure injected while the test connection is active
+type fault struct {
+	// Name is the name of the fault
+	Name string
+	// Target returns whether the pod is the one the fault is injected
+	// into, given the pods of the test connection
+	Target func(pod *corev1.Pod, client *corev1.Pod) bool
+	// NodeScoped faults target the NSM pods of the node of the client,
+	// which run in the namespace NSM is installed to rather than in the
+	// one of the test connection
+	NodeScoped bool
+}
+
+// faults maps the fault names to the faults. Each fault deletes a pod on
+// the path of the test connection, which its controller then replaces
+var faults = map[string]fault{
+	// forwarder deletes the forwarder of the node of the client
+	"forwarder": {
+		Name: "forwarder",
+		Target: func(pod, client *corev1.Pod) bool {
+			return strings.HasPrefix(pod.Name, "forwarder") && pod.Spec.NodeName == client.Spec.NodeName
+		},
+		NodeScoped: true,
+	},
+	// nsmgr deletes the NSM manager of the node of the client
+	"nsmgr": {
+		Name: "nsmgr",
+		Target: func(pod, client *corev1.Pod) bool {
+			return strings.HasPrefix(pod.Name, "nsmgr") && pod.Spec.NodeName == client.Spec.NodeName
+		},
+		NodeScoped: true,
+	},
+	// nse restarts the NSE of the test connection
+	"nse": {
+		Name: "nse",
+		Target: func(pod, _ *corev1.Pod) bool {
+			return pod.Labels["app"] == healConnection+"-nse"
+		},
+	},
+}
+
+// healOptions are the options of the heal verification
+type healOptions struct {
+	// Faults are the names of the faults injected one after the other,
+	// all of them when not set
+	Faults []string `json:"faults,omitempty"`
+	// Timeout is the time the test connection is given to heal from each
+	// fault, e.g. 2m
+	Timeout string `json:"timeout,omitempty"`
+	// Image is the test image of the client of the test connection
+	Image string `json:"image,omitempty"`
+	// Keep keeps the test connection once the verification is done
+	Keep bool `json:"keep,omitempty"`
+	// Cluster is the index of the kubeconfig of the cluster the faults
+	// are injected on
+	Cluster int `json:"cluster,omitempty"`
+}
+
+// healResult is the outcome of a fault injected into the test connection
+type healResult struct {
+	Fault string `json:"fault"`
+	// Pod is the pod deleted by the fault and Replacement the pod which
+	// replaced it
+	Pod         string `json:"pod"`
+	Replacement string `json:"replacement,omitempty"`
+	// Disrupted reports whether any probe of the connection failed
+	// after the fault
+	Disrupted bool `json:"disrupted"`
+	// DowntimeMs is the time between the first and the last failed
+	// probe, in milliseconds
+	DowntimeMs float64 `json:"downtimeMs"`
+	// TimeToHealMs is the time from the fault until the replacement pod
+	// is ready and the connection works again, in milliseconds
+	TimeToHealMs float64 `json:"timeToHealMs"`
+	Recovered    bool    `json:"recovered"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// healReport is the report of the heal verification
+type healReport struct {
+	Cluster   string       `json:"cluster"`
+	Recovered bool         `json:"recovered"`
+	Results   []healResult `json:"results"`
+}
+
+// verifyHealing sets up a test connection on the cluster, injects each of
+// the faults into it and measures the time the connection takes to heal,
+// streaming the outcome of each fault as an event
+func (mesh *Mesh) verifyHealing(ctx context.Context, opID, namespace string, opts healOptions, kubeconfigs []string) (*healReport, error) {
+	if opts.Cluster < 0 || opts.Cluster >= len(kubeconfigs) {
+		return nil, ErrHeal(fmt.Errorf("cluster index %d out of range", opts.Cluster))
+	}
+	if len(opts.Faults) == 0 {
+		opts.Faults = []string{"forwarder", "nsmgr", "nse"}
+	}
+	timeout := defaultHealTimeout
+	if opts.Timeout != "" {
+		d, err := time.ParseDuration(opts.Timeout)
+		if err != nil {
+			return nil, ErrHeal(err)
+		}
+		timeout = d
+	}
+
+	injected := make([]fault, 0, len(opts.Faults))
+	for _, name := range opts.Faults {
+		f, ok := faults[name]
+		if !ok {
+			return nil, ErrHeal(fmt.Errorf("unsupported fault: %s", name))
+		}
+		injected = append(injected, f)
+	}
+
+	config := kubeconfigs[opts.Cluster]
+	cluster := clusterName(opts.Cluster)
+	kClient, err := mesherykube.New([]byte(config))
+	if err != nil {
+		return nil, ErrHeal(err)
+	}
+
+	// The test connection is a kernel client connected to a kernel NSE
+	dp := datapaths["kernel"]
+	dp.Iperf = false
+	values := benchmarkValues{
+		Name:      healConnection,
+		Path:      dp,
+		CIDR:      benchmarkCIDR,
+		Tag:       nsmImageTag(ctx, kClient, benchmarkImageTag),
+		TestImage: opts.Image,
+	}
+	var manifest bytes.Buffer
+	if err := benchmarkTemplate.Execute(&manifest, values); err != nil {
+		return nil, ErrHeal(err)
+	}
+	if err := mesh.applyManifestToCluster(ctx, cluster, config, manifest.Bytes(), false, namespace); err != nil {
+		return nil, ErrHeal(err)
+	}
+	report := &healReport{Cluster: kubeContextName(config, cluster), Recovered: true}
+	if dr := dryRunFrom(ctx); dr != nil {
+		for _, f := range injected {
+			dr.record(plannedChange{Cluster: cluster, Action: plannedRun, Object: fmt.Sprintf("%s fault", f.Name)})
+		}
+		return report, nil
+	}
+	if !opts.Keep {
+		defer func() {
+			if err := mesh.applyManifestToCluster(ctx, cluster, config, manifest.Bytes(), true, namespace); err != nil {
+				mesh.Log.Warn(ErrHeal(err))
+			}
+		}()
+	}
+
+	for _, f := range injected {
+		// Each fault is injected into a working connection
+		pod, err := waitForConnection(kClient, namespace, values)
+		if err != nil {
+			return report, ErrHeal(err)
+		}
+		result := injectFault(ctx, kClient, namespace, pod, f, timeout)
+		report.Results = append(report.Results, result)
+		report.Recovered = report.Recovered && result.Recovered
+		mesh.streamHealResult(opID, result)
+	}
+	return report, nil
+}
+
+// injectFault deletes the pod targeted by the fault and probes the test
+// connection of the client pod until the pod is replaced and the
+// connection works again, or the timeout expires
+func injectFault(ctx context.Context, kClient *mesherykube.Client, namespace, clientPod string, f fault, timeout time.Duration) healResult {
+	result := healResult{Fault: f.Name}
+	pods := kClient.KubeClient.CoreV1().Pods(namespace)
+
+	client, err := pods.Get(ctx, clientPod, metav1.GetOptions{})
+	if err != nil {
+		result.Error = ErrFindPod(clientPod, err).Error()
+		return result
+	}
+	target, err := faultTarget(ctx, kClient, namespace, f, client)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Pod = target.Name
+
+	// The pod is killed rather than gracefully stopped
+	grace := int64(0)
+	injected := time.Now()
+	if err := kClient.KubeClient.CoreV1().Pods(target.Namespace).Delete(ctx, target.Name, metav1.DeleteOptions{GracePeriodSeconds: &grace}); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	var firstFailure, lastFailure time.Time
+	deadline := injected.Add(timeout)
+	for time.Now().Before(deadline) {
+		probed := time.Now()
+		rtts, _ := pingNSE(kClient, namespace, clientPod, datapaths["kernel"], 1)
+		if len(rtts) == 0 {
+			if firstFailure.IsZero() {
+				firstFailure = probed
+			}
+			lastFailure = probed
+		} else if result.Replacement == "" {
+			result.Replacement = replacementPod(ctx, kClient, namespace, f, client, target)
+		}
+		if len(rtts) != 0 && result.Replacement != "" {
+			result.Recovered = true
+			result.TimeToHealMs = milliseconds(time.Since(injected))
+			break
+		}
+		time.Sleep(time.Until(probed.Add(healProbeInterval)))
+	}
+
+	result.Disrupted = !firstFailure.IsZero()
+	if result.Disrupted {
+		result.DowntimeMs = milliseconds(lastFailure.Sub(firstFailure) + healProbeInterval)
+	}
+	if !result.Recovered {
+		result.Error = fmt.Sprintf("connection did not heal within %s", timeout)
+	}
+	return result
+}
+
+// milliseconds returns the duration in milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// searchNamespace returns the namespace the targets of the fault are looked
+// up in, all of the namespaces for the node scoped faults since NSM may be
+// installed to another namespace than the test connection
+func (f fault) searchNamespace(namespace string) string {
+	if f.NodeScoped {
+		return metav1.NamespaceAll
+	}
+	return namespace
+}
+
+// faultTarget returns the pod the fault is injected into
+func faultTarget(ctx context.Context, kClient *mesherykube.Client, namespace string, f fault, client *corev1.Pod) (*corev1.Pod, error) {
+	pods, err := kClient.KubeClient.CoreV1().Pods(f.searchNamespace(namespace)).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil && f.Target(pod, client) {
+			return pod, nil
+		}
+	}
+	return nil, fmt.Errorf("no running %s pod found for client %s on node %s", f.Name, client.Name, client.Spec.NodeName)
+}
+
+// replacementPod returns the name of the pod which replaced the target of
+// the fault once it is ready, empty until then
+func replacementPod(ctx context.Context, kClient *mesherykube.Client, namespace string, f fault, client, target *corev1.Pod) string {
+	pods, err := kClient.KubeClient.CoreV1().Pods(f.searchNamespace(namespace)).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return ""
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.UID == target.UID || pod.Namespace != target.Namespace || pod.DeletionTimestamp != nil || !f.Target(pod, client) {
+			continue
+		}
+		if podReady(pod) {
+			return pod.Name
+		}
+	}
+	return ""
+}
+
+// podReady returns whether the pod is running and ready
+func podReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// streamHealResult streams the outcome of the fault
+func (mesh *Mesh) streamHealResult(opID string, result healResult) {
+	e := &meshes.EventsResponse{
+		OperationId:   opID,
+		Component:     internalconfig.ServerConfig["type"],
+		ComponentName: internalconfig.ServerConfig["name"],
+	}
+
+	details, err := json.Marshal(result)
+	if err != nil {
+		mesh.streamErr("Error while encoding heal result", e, ErrHeal(err))
+		return
+	}
+	if result.Recovered {
+		e.Summary = fmt.Sprintf("Connection healed from %s fault in %.0fms", result.Fault, result.TimeToHealMs)
+	} else {
+		e.Summary = fmt.Sprintf("Connection did not heal from %s fault", result.Fault)
+	}
+	e.Details = string(details)
+	mesh.StreamInfo(e)
+}
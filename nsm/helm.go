@@ -0,0 +1,175 @@
+package nsm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/layer5io/meshery-nsm/internal/metrics"
+	"github.com/layer5io/meshkit/utils"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"helm.sh/helm/v3/pkg/action"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/postrender"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// nsmHelmRepo is the helm repository of the NSM charts
+const nsmHelmRepo = "https://helm.nsm.dev/"
+
+// loadHelmChart downloads the chart from the NSM helm repository and loads it
+func loadHelmChart(chart, version string) (*helmchart.Chart, error) {
+	chartURL, err := repo.FindChartInRepoURL(nsmHelmRepo, chart, version, "", "", "", getter.All(cli.New()))
+	if err != nil {
+		metrics.FetchFailed(metrics.SourceHelm)
+		return nil, err
+	}
+
+	// The chart archive is cached in the same location as the one
+	// used by meshkit for installing the charts
+	localPath := filepath.Join(os.TempDir(), filepath.Base(chartURL))
+	if _, err := os.Stat(localPath); err != nil {
+		if err := utils.DownloadFile(localPath, chartURL); err != nil {
+			metrics.FetchFailed(metrics.SourceHelm)
+			return nil, err
+		}
+	}
+	return loader.Load(localPath)
+}
+
+// renderHelmChart renders the chart from the NSM helm repository into a
+// manifest without contacting any cluster. The post renderer, if any, is
+// run on the rendered manifest
+func renderHelmChart(chart, version, namespace string, values map[string]interface{}, pr postrender.PostRenderer) (string, error) {
+	helmChart, err := loadHelmChart(chart, version)
+	if err != nil {
+		return "", ErrRenderHelmChart(chart, err)
+	}
+
+	act := action.NewInstall(&action.Configuration{})
+	act.PostRenderer = pr
+	act.DryRun = true
+	act.ClientOnly = true
+	act.Replace = true
+	act.IncludeCRDs = true
+	act.ReleaseName = chart
+	act.Namespace = namespace
+	rel, err := act.Run(helmChart, values)
+	if err != nil {
+		return "", ErrRenderHelmChart(chart, err)
+	}
+	return rel.Manifest, nil
+}
+
+// restClientGetter provides the helm actions with the clients of a rest config
+type restClientGetter struct {
+	config    rest.Config
+	namespace string
+}
+
+func (g *restClientGetter) ToRESTConfig() (*rest.Config, error) {
+	config := g.config
+	return &config, nil
+}
+
+func (g *restClientGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	config := g.config
+	dc, err := discovery.NewDiscoveryClientForConfig(&config)
+	if err != nil {
+		return nil, err
+	}
+	return memory.NewMemCacheClient(dc), nil
+}
+
+func (g *restClientGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	dc, err := g.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	return restmapper.NewDeferredDiscoveryRESTMapper(dc), nil
+}
+
+func (g *restClientGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	return clientcmd.NewDefaultClientConfig(*clientcmdapi.NewConfig(), &clientcmd.ConfigOverrides{
+		Context: clientcmdapi.Context{Namespace: g.namespace},
+	})
+}
+
+// helmActionConfig returns the configuration of the helm actions on the
+// namespace of the cluster, the releases are stored as secrets
+func helmActionConfig(kClient *mesherykube.Client, namespace string) (*action.Configuration, error) {
+	actionConfig := new(action.Configuration)
+	getter := &restClientGetter{config: kClient.RestConfig, namespace: namespace}
+	if err := actionConfig.Init(getter, namespace, string(mesherykube.Secret), func(string, ...interface{}) {}); err != nil {
+		return nil, err
+	}
+	return actionConfig, nil
+}
+
+// installHelmChart installs, upgrades or uninstalls the chart from the NSM
+// helm repository like meshkit does, running the post renderer, if any,
+// on the rendered manifest of installs and upgrades
+func installHelmChart(kClient *mesherykube.Client, chart, version, namespace string, values map[string]interface{}, isDel bool, pr postrender.PostRenderer) error {
+	actionConfig, err := helmActionConfig(kClient, namespace)
+	if err != nil {
+		return ErrApplyHelmChart(err)
+	}
+
+	if isDel {
+		if _, err := action.NewUninstall(actionConfig).Run(chart); err != nil {
+			return ErrApplyHelmChart(err)
+		}
+		return nil
+	}
+
+	helmChart, err := loadHelmChart(chart, version)
+	if err != nil {
+		return ErrApplyHelmChart(err)
+	}
+
+	_, err = action.NewGet(actionConfig).Run(chart)
+	switch {
+	case errors.Is(err, driver.ErrReleaseNotFound):
+		act := action.NewInstall(actionConfig)
+		act.ReleaseName = chart
+		act.Namespace = namespace
+		act.CreateNamespace = true
+		act.PostRenderer = pr
+		_, err = act.Run(helmChart, values)
+	case err == nil:
+		act := action.NewUpgrade(actionConfig)
+		act.Namespace = namespace
+		act.PostRenderer = pr
+		_, err = act.Run(chart, helmChart, values)
+	}
+	if err != nil {
+		return ErrApplyHelmChart(err)
+	}
+	return nil
+}
+
+// getHelmRelease returns the deployed helm release from the cluster
+func getHelmRelease(kClient *mesherykube.Client, namespace, name string) (*release.Release, error) {
+	actionConfig, err := helmActionConfig(kClient, namespace)
+	if err != nil {
+		return nil, ErrGetHelmRelease(name, err)
+	}
+
+	rel, err := action.NewGet(actionConfig).Run(name)
+	if err != nil {
+		return nil, ErrGetHelmRelease(name, err)
+	}
+	return rel, nil
+}
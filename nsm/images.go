@@ -0,0 +1,208 @@
+package nsm
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/docker/distribution/reference"
+	"helm.sh/helm/v3/pkg/postrender"
+	"sigs.k8s.io/yaml"
+)
+
+// containerFields are the fields of the pod specs which hold the lists
+// of containers whose images are rewritten
+var containerFields = []string{"containers", "initContainers", "ephemeralContainers"}
+
+// ImageRewriteOptions configures the rewriting of the image references of
+// the helm charts and the manifests applied by the adapter
+type ImageRewriteOptions struct {
+	// Mirrors maps a registry, or a repository prefix within a registry,
+	// to its mirror, e.g. "ghcr.io/networkservicemesh" to
+	// "registry.local/nsm". The longest matching prefix is used
+	Mirrors map[string]string
+	// PinDigests resolves the tags of the rewritten images to the digests
+	// served by the mirrors and pins the images to them
+	PinDigests bool
+}
+
+// RewriteImages rewrites the image references of the helm charts and the
+// manifests applied by the adapter from then on
+func (mesh *Mesh) RewriteImages(opts ImageRewriteOptions) {
+	if len(opts.Mirrors) == 0 && !opts.PinDigests {
+		mesh.images = nil
+		return
+	}
+	mesh.images = newImageRewriter(opts)
+}
+
+// imageRewriter rewrites the image references of the objects. A nil
+// rewriter leaves the images unchanged
+type imageRewriter struct {
+	// prefixes are the mirrored prefixes sorted from the longest
+	prefixes   []string
+	mirrors    map[string]string
+	pinDigests bool
+	resolver   remotes.Resolver
+
+	mx      sync.Mutex
+	digests map[string]string
+}
+
+func newImageRewriter(opts ImageRewriteOptions) *imageRewriter {
+	r := &imageRewriter{
+		mirrors:    make(map[string]string, len(opts.Mirrors)),
+		pinDigests: opts.PinDigests,
+		resolver:   docker.NewResolver(docker.ResolverOptions{}),
+		digests:    make(map[string]string),
+	}
+	for prefix, mirror := range opts.Mirrors {
+		prefix = strings.TrimSuffix(prefix, "/")
+		r.mirrors[prefix] = strings.TrimSuffix(mirror, "/")
+		r.prefixes = append(r.prefixes, prefix)
+	}
+	sort.Slice(r.prefixes, func(i, j int) bool {
+		return len(r.prefixes[i]) > len(r.prefixes[j])
+	})
+	return r
+}
+
+// rewrite returns the image reference with the mirror of its registry
+// and, if requested, pinned to its digest
+func (r *imageRewriter) rewrite(ctx context.Context, image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", ErrRewriteImage(image, err)
+	}
+
+	name := named.Name()
+	for _, prefix := range r.prefixes {
+		if name == prefix || strings.HasPrefix(name, prefix+"/") {
+			name = r.mirrors[prefix] + strings.TrimPrefix(name, prefix)
+			break
+		}
+	}
+
+	rewritten := name
+	tagged, isTagged := named.(reference.Tagged)
+	if isTagged {
+		rewritten += ":" + tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		return rewritten + "@" + digested.Digest().String(), nil
+	}
+	if !r.pinDigests {
+		return rewritten, nil
+	}
+
+	if !isTagged {
+		rewritten += ":latest"
+	}
+	digest, err := r.resolveDigest(ctx, rewritten)
+	if err != nil {
+		return "", ErrRewriteImage(image, err)
+	}
+	return rewritten + "@" + digest, nil
+}
+
+// resolveDigest returns the digest of the image served by its registry
+func (r *imageRewriter) resolveDigest(ctx context.Context, image string) (string, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if digest, ok := r.digests[image]; ok {
+		return digest, nil
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	_, desc, err := r.resolver.Resolve(ctx, named.String())
+	if err != nil {
+		return "", err
+	}
+	r.digests[image] = desc.Digest.String()
+	return r.digests[image], nil
+}
+
+// rewriteObject rewrites the images of the containers found anywhere in
+// the object, which covers the pod templates of all of the workloads
+func (r *imageRewriter) rewriteObject(ctx context.Context, obj map[string]interface{}) error {
+	for k, v := range obj {
+		switch field := v.(type) {
+		case map[string]interface{}:
+			if err := r.rewriteObject(ctx, field); err != nil {
+				return err
+			}
+		case []interface{}:
+			isContainers := false
+			for _, f := range containerFields {
+				isContainers = isContainers || k == f
+			}
+			for _, item := range field {
+				item, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if image, ok := item["image"].(string); ok && isContainers {
+					rewritten, err := r.rewrite(ctx, image)
+					if err != nil {
+						return err
+					}
+					item["image"] = rewritten
+				}
+				if err := r.rewriteObject(ctx, item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteManifest rewrites the images of the objects of the manifest
+func (r *imageRewriter) rewriteManifest(ctx context.Context, contents []byte) ([]byte, error) {
+	if r == nil {
+		return contents, nil
+	}
+
+	objects, err := decodeManifest(contents)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, obj := range objects {
+		if err := r.rewriteObject(ctx, obj.Object); err != nil {
+			return nil, err
+		}
+		out, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, ErrRewriteImage(objectRef(obj), err)
+		}
+		buf.WriteString("---\n")
+		buf.Write(out)
+	}
+	return buf.Bytes(), nil
+}
+
+// Run rewrites the images of the rendered helm chart
+func (r *imageRewriter) Run(rendered *bytes.Buffer) (*bytes.Buffer, error) {
+	out, err := r.rewriteManifest(context.Background(), rendered.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(out), nil
+}
+
+// postRenderer returns the rewriter as a helm post renderer, nil if the
+// images are not rewritten
+func (r *imageRewriter) postRenderer() postrender.PostRenderer {
+	if r == nil {
+		return nil
+	}
+	return r
+}
@@ -0,0 +1,276 @@
+package nsm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	nginxDigest  = "sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"
+	latestDigest = "sha256:9b2a28eb47540823042a2ba401386845089bb7b62a9637d55816132c4c3c36eb"
+	nsmgrDigest  = "sha256:4f2c1a3f7d8e9b0a1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b"
+)
+
+// digestResolver resolves the references of its digests and fails for
+// any other reference, it is never used to fetch or push
+type digestResolver struct {
+	remotes.Resolver
+	digests  map[string]string
+	resolved []string
+}
+
+func (r *digestResolver) Resolve(_ context.Context, ref string) (string, ocispec.Descriptor, error) {
+	r.resolved = append(r.resolved, ref)
+	d, ok := r.digests[ref]
+	if !ok {
+		return "", ocispec.Descriptor{}, fmt.Errorf("%s: not found", ref)
+	}
+	return ref, ocispec.Descriptor{Digest: digest.Digest(d)}, nil
+}
+
+// testImageRewriter returns a rewriter with overlapping mirrored prefixes
+// resolving the digests with a digestResolver
+func testImageRewriter(pinDigests bool) (*imageRewriter, *digestResolver) {
+	r := newImageRewriter(ImageRewriteOptions{
+		Mirrors: map[string]string{
+			"docker.io":                   "mirror.local/docker/",
+			"ghcr.io":                     "mirror.local/ghcr",
+			"ghcr.io/networkservicemesh/": "registry.local/nsm",
+		},
+		PinDigests: pinDigests,
+	})
+	resolver := &digestResolver{digests: map[string]string{
+		"mirror.local/docker/library/nginx:1.23":   nginxDigest,
+		"mirror.local/docker/library/nginx:latest": latestDigest,
+		"registry.local/nsm/cmd-nsmgr:v1.6.0":      nsmgrDigest,
+	}}
+	r.resolver = resolver
+	return r, resolver
+}
+
+func TestImageRewriterRewrite(t *testing.T) {
+	tests := []struct {
+		name         string
+		image        string
+		pinDigests   bool
+		want         string
+		wantResolved []string
+		wantErr      bool
+	}{
+		{
+			name:  "short name",
+			image: "nginx",
+			want:  "mirror.local/docker/library/nginx",
+		},
+		{
+			name:  "fully qualified name",
+			image: "docker.io/library/nginx",
+			want:  "mirror.local/docker/library/nginx",
+		},
+		{
+			name:  "short name with tag",
+			image: "nginx:1.23",
+			want:  "mirror.local/docker/library/nginx:1.23",
+		},
+		{
+			name:  "longest prefix",
+			image: "ghcr.io/networkservicemesh/cmd-nsmgr:v1.6.0",
+			want:  "registry.local/nsm/cmd-nsmgr:v1.6.0",
+		},
+		{
+			name:  "shorter prefix",
+			image: "ghcr.io/spiffe/spire-server:1.2.2",
+			want:  "mirror.local/ghcr/spiffe/spire-server:1.2.2",
+		},
+		{
+			name:  "prefix matches whole path elements",
+			image: "ghcr.io/networkservicemesh-x/app:v1.0",
+			want:  "mirror.local/ghcr/networkservicemesh-x/app:v1.0",
+		},
+		{
+			name:  "not mirrored",
+			image: "quay.io/coreos/etcd:v3.5.0",
+			want:  "quay.io/coreos/etcd:v3.5.0",
+		},
+		{
+			name:         "pinned tag",
+			image:        "nginx:1.23",
+			pinDigests:   true,
+			want:         "mirror.local/docker/library/nginx:1.23@" + nginxDigest,
+			wantResolved: []string{"mirror.local/docker/library/nginx:1.23"},
+		},
+		{
+			name:         "pinned latest",
+			image:        "docker.io/library/nginx",
+			pinDigests:   true,
+			want:         "mirror.local/docker/library/nginx:latest@" + latestDigest,
+			wantResolved: []string{"mirror.local/docker/library/nginx:latest"},
+		},
+		{
+			name:       "already digested",
+			image:      "nginx@" + nginxDigest,
+			pinDigests: true,
+			want:       "mirror.local/docker/library/nginx@" + nginxDigest,
+		},
+		{
+			name:       "already digested with tag",
+			image:      "ghcr.io/networkservicemesh/cmd-nsmgr:v1.6.0@" + nginxDigest,
+			pinDigests: true,
+			want:       "registry.local/nsm/cmd-nsmgr:v1.6.0@" + nginxDigest,
+		},
+		{
+			name:         "unresolved digest",
+			image:        "quay.io/coreos/etcd:v3.5.0",
+			pinDigests:   true,
+			wantResolved: []string{"quay.io/coreos/etcd:v3.5.0"},
+			wantErr:      true,
+		},
+		{
+			name:    "invalid reference",
+			image:   "Nginx:1.23",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, resolver := testImageRewriter(tt.pinDigests)
+			got, err := r.rewrite(context.Background(), tt.image)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rewrite(%q) error = %v, wantErr %v", tt.image, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("rewrite(%q) = %q, want %q", tt.image, got, tt.want)
+			}
+			if !reflect.DeepEqual(resolver.resolved, tt.wantResolved) {
+				t.Errorf("rewrite(%q) resolved %v, want %v", tt.image, resolver.resolved, tt.wantResolved)
+			}
+		})
+	}
+}
+
+func TestImageRewriterResolvesDigestsOnce(t *testing.T) {
+	r, resolver := testImageRewriter(true)
+	for _, image := range []string{"nginx:1.23", "docker.io/library/nginx:1.23"} {
+		if _, err := r.rewrite(context.Background(), image); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(resolver.resolved) != 1 {
+		t.Errorf("resolved %v, want a single resolution", resolver.resolved)
+	}
+}
+
+const workloadManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nsmgr
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: init
+          image: nginx:1.23
+      containers:
+        - name: nsmgr
+          image: ghcr.io/networkservicemesh/cmd-nsmgr:v1.6.0
+        - name: exporter
+          image: quay.io/coreos/etcd:v3.5.0
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: images
+data:
+  image: nginx:1.23
+`
+
+// manifestImages returns the images of the containers of the pod template
+// of the deployment and the image field of the config map
+func manifestImages(t *testing.T, manifest []byte) (init, containers []string, data string) {
+	t.Helper()
+	objects, err := decodeManifest(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("decoded %d objects, want 2", len(objects))
+	}
+	images := func(field string) []string {
+		list, _, _ := unstructured.NestedSlice(objects[0].Object, "spec", "template", "spec", field)
+		var images []string
+		for _, c := range list {
+			images = append(images, c.(map[string]interface{})["image"].(string))
+		}
+		return images
+	}
+	data, _ = objects[1].Object["data"].(map[string]interface{})["image"].(string)
+	return images("initContainers"), images("containers"), data
+}
+
+func TestRewriteManifest(t *testing.T) {
+	tests := []struct {
+		name           string
+		pinDigests     bool
+		wantInit       []string
+		wantContainers []string
+		wantErr        bool
+	}{
+		{
+			name:     "mirrors",
+			wantInit: []string{"mirror.local/docker/library/nginx:1.23"},
+			wantContainers: []string{
+				"registry.local/nsm/cmd-nsmgr:v1.6.0",
+				"quay.io/coreos/etcd:v3.5.0",
+			},
+		},
+		{
+			name:       "unresolved digest",
+			pinDigests: true,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := testImageRewriter(tt.pinDigests)
+			out, err := r.postRenderer().Run(bytes.NewBufferString(workloadManifest))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			init, containers, data := manifestImages(t, out.Bytes())
+			if !reflect.DeepEqual(init, tt.wantInit) {
+				t.Errorf("init container images = %v, want %v", init, tt.wantInit)
+			}
+			if !reflect.DeepEqual(containers, tt.wantContainers) {
+				t.Errorf("container images = %v, want %v", containers, tt.wantContainers)
+			}
+			if data != "nginx:1.23" {
+				t.Errorf("config map image = %q, want it unchanged", data)
+			}
+		})
+	}
+}
+
+func TestNilImageRewriter(t *testing.T) {
+	var r *imageRewriter
+	if r.postRenderer() != nil {
+		t.Error("postRenderer() of a nil rewriter is not nil")
+	}
+	out, err := r.rewriteManifest(context.Background(), []byte(workloadManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != workloadManifest {
+		t.Errorf("rewriteManifest() = %q, want the manifest unchanged", out)
+	}
+}
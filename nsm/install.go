@@ -1,16 +1,23 @@
 package nsm
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-adapter-library/status"
+	internalconfig "github.com/layer5io/meshery-nsm/internal/config"
+	"github.com/layer5io/meshery-nsm/internal/metrics"
+	"github.com/layer5io/meshery-nsm/internal/tracing"
 	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"go.opentelemetry.io/otel/label"
 )
 
-func (mesh *Mesh) installNSMMesh(del bool, version, namespace string, kubeconfigs []string) (string, error) {
+func (mesh *Mesh) installNSMMesh(ctx context.Context, opID string, del bool, version, namespace, forwarder string, kubeconfigs []string) (string, error) {
 	mesh.Log.Debug(fmt.Sprintf("Requested install of version: %s", version))
+	mesh.Log.Debug(fmt.Sprintf("Requested forwarder: %s", forwarder))
 	mesh.Log.Debug(fmt.Sprintf("Requested action is delete: %v", del))
 	mesh.Log.Debug(fmt.Sprintf("Requested action is in namespace: %s", namespace))
 
@@ -24,7 +31,18 @@ func (mesh *Mesh) installNSMMesh(del bool, version, namespace string, kubeconfig
 		return st, ErrMeshConfig(err)
 	}
 
-	if err := mesh.applyHelmChart(version, namespace, del, kubeconfigs); err != nil {
+	forwarder, profile, err := getForwarderProfile(forwarder)
+	if err != nil {
+		return st, err
+	}
+
+	if !del {
+		if err := mesh.preflight(opID, version, namespace, forwarder, kubeconfigs); err != nil {
+			return st, err
+		}
+	}
+
+	if err := mesh.applyHelmChart(ctx, internalconfig.NSMChart, version, namespace, profile.Values, del, kubeconfigs); err != nil {
 		return st, ErrApplyHelmChart(err)
 	}
 
@@ -36,46 +54,21 @@ func (mesh *Mesh) installNSMMesh(del bool, version, namespace string, kubeconfig
 	return st, nil
 }
 
-func (mesh *Mesh) applyHelmChart(version, namespace string, isDel bool, kubeconfigs []string) error {
-	repo := "https://helm.nsm.dev/"
-
-	var act mesherykube.HelmChartAction
-	if isDel {
-		act = mesherykube.UNINSTALL
-	} else {
-		act = mesherykube.INSTALL
-	}
+func (mesh *Mesh) applyHelmChart(ctx context.Context, chart, version, namespace string, values map[string]interface{}, isDel bool, kubeconfigs []string) error {
 	var wg sync.WaitGroup
 	var errs []error
 	var errMx sync.Mutex
-	for _, config := range kubeconfigs {
+	for i, config := range kubeconfigs {
 		wg.Add(1)
-		go func(config string) {
+		go func(cluster, config string) {
 			defer wg.Done()
-			kClient, err := mesherykube.New([]byte(config))
+			err := mesh.applyRecordedHelmChart(ctx, cluster, config, chart, version, namespace, values, isDel)
 			if err != nil {
 				errMx.Lock()
 				errs = append(errs, err)
 				errMx.Unlock()
-				return
 			}
-			err = kClient.ApplyHelmChart(mesherykube.ApplyHelmChartConfig{
-				ChartLocation: mesherykube.HelmChartLocation{
-					Repository: repo,
-					// Chart:      chart,
-					Version: version,
-				},
-				Namespace:       namespace,
-				Action:          act,
-				CreateNamespace: true,
-			})
-			if err != nil {
-				errMx.Lock()
-				errs = append(errs, err)
-				errMx.Unlock()
-				return
-			}
-		}(config)
+		}(clusterName(i), config)
 	}
 	wg.Wait()
 	if len(errs) != 0 {
@@ -83,3 +76,93 @@ func (mesh *Mesh) applyHelmChart(version, namespace string, isDel bool, kubeconf
 	}
 	return nil
 }
+
+// applyRecordedHelmChart applies the chart to the cluster like
+// applyHelmChartToCluster, and records the install in the journal and the
+// NSM installs in the targets of the reconciler once it succeeded
+func (mesh *Mesh) applyRecordedHelmChart(ctx context.Context, cluster, config, chart, version, namespace string, values map[string]interface{}, isDel bool) error {
+	if err := mesh.applyHelmChartToCluster(ctx, cluster, config, chart, version, namespace, values, isDel); err != nil {
+		return err
+	}
+	if dryRunFrom(ctx) != nil {
+		return nil
+	}
+	if chart == internalconfig.NSMChart {
+		mesh.targets.track(cluster, namespace, config, isDel)
+	}
+	err := mesh.journal.recordInstall(journalInstall{
+		Cluster:   kubeContextName(config, cluster),
+		Namespace: namespace,
+		Chart:     chart,
+		Version:   version,
+		Values:    values,
+		Config:    config,
+	}, isDel)
+	if err != nil {
+		mesh.Log.Warn(err)
+	}
+	return nil
+}
+
+// applyHelmChartToCluster installs or uninstalls the chart on the cluster
+// of a single kubeconfig. For dry-run operations the chart is rendered and
+// the changes it would make are recorded instead
+func (mesh *Mesh) applyHelmChartToCluster(ctx context.Context, cluster, config, chart, version, namespace string, values map[string]interface{}, isDel bool) (err error) {
+	name := kubeContextName(config, cluster)
+	ctx, span := tracing.Start(ctx, "cluster",
+		label.String("cluster", name),
+		label.String("namespace", namespace),
+	)
+	defer func(started time.Time) {
+		metrics.ObserveApply(name, metrics.ApplyHelm, started, err)
+		tracing.End(ctx, span, err)
+	}(time.Now())
+
+	spanName := "helm.install"
+	if isDel {
+		spanName = "helm.uninstall"
+	}
+
+	kClient, err := mesherykube.New([]byte(config))
+	if err != nil {
+		return err
+	}
+
+	// Uninstall the chart version which was installed, which may differ
+	// from the requested one, and report upgrades of the installed version
+	install, err := mesh.journal.install(name, namespace, chart)
+	if err != nil {
+		mesh.Log.Warn(err)
+	}
+	if install != nil && install.Version != version {
+		if isDel {
+			version = install.Version
+		} else {
+			mesh.Log.Info(fmt.Sprintf("Upgrading %s on %s from %s to %s", chart, cluster, install.Version, version))
+		}
+	}
+
+	ctx, helmSpan := tracing.Start(ctx, spanName,
+		label.String("chart", chart),
+		label.String("version", version),
+	)
+	defer func() { tracing.End(ctx, helmSpan, err) }()
+
+	if report := dryRunFrom(ctx); report != nil {
+		helmSpan.SetName("helm.render")
+		manifest, err := renderHelmChart(chart, version, namespace, values, mesh.images.postRenderer())
+		if err != nil {
+			return err
+		}
+		changes, err := dryRunManifest(ctx, kClient, cluster, []byte(manifest), isDel, namespace)
+		if err != nil {
+			return err
+		}
+		report.record(changes...)
+		return nil
+	}
+
+	// The chart is always loaded by the adapter, rather than by meshkit,
+	// for its fetch failures to be counted
+	return installHelmChart(kClient, chart, version, namespace, values, isDel, mesh.images.postRenderer())
+}
@@ -0,0 +1,373 @@
+package nsm
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	internalconfig "github.com/layer5io/meshery-nsm/internal/config"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// exposedDNSService is the name of the service which exposes the
+	// cluster DNS to the other clusters of the interdomain topology
+	exposedDNSService = "nsm-exposed-kube-dns"
+
+	// coreDNSConfigMap is the name of the CoreDNS config map
+	coreDNSConfigMap = "coredns"
+
+	// spireServerSelector selects the SPIRE server pod
+	spireServerSelector = "app=spire-server"
+	// spireServerContainer is the container of the SPIRE server pod
+	spireServerContainer = "spire-server"
+
+	// interdomainDNSBegin and interdomainDNSEnd delimit the part of the
+	// Corefile managed by the adapter
+	interdomainDNSBegin = "# nsm-interdomain begin"
+	interdomainDNSEnd   = "# nsm-interdomain end"
+
+	// loadBalancerTimeout is the time to wait for the exposed DNS service
+	// to get an external address
+	loadBalancerTimeout = 5 * time.Minute
+)
+
+// interdomainDNSBlock matches the part of the Corefile managed by the adapter
+var interdomainDNSBlock = regexp.MustCompile(`(?s)\n?` + interdomainDNSBegin + `.*` + interdomainDNSEnd + `\n?`)
+
+// interdomainCluster holds the state of a single cluster of the interdomain topology
+type interdomainCluster struct {
+	Name    string
+	Domain  string
+	Config  string
+	Client  *mesherykube.Client
+	DNSAddr string
+	Bundle  string
+}
+
+// interdomainDomain returns the DNS and trust domain of the i-th cluster
+func interdomainDomain(i int) string {
+	return fmt.Sprintf("%s.nsm", clusterName(i))
+}
+
+// installInterdomain installs NSM on each of the clusters and federates them
+// into a single interdomain topology
+func (mesh *Mesh) installInterdomain(ctx context.Context, opID string, del bool, version, namespace, forwarder string, kubeconfigs []string) (string, error) {
+	st := status.Installing
+	if del {
+		st = status.Removing
+	}
+
+	if len(kubeconfigs) < 2 {
+		return st, ErrInterdomainClusters(len(kubeconfigs))
+	}
+
+	forwarder, profile, err := getForwarderProfile(forwarder)
+	if err != nil {
+		return st, err
+	}
+
+	clusters, err := newInterdomainClusters(kubeconfigs)
+	if err != nil {
+		return st, ErrInterdomain(err)
+	}
+
+	if del {
+		if err := mesh.teardownInterdomain(ctx, version, namespace, clusters); err != nil {
+			return st, ErrInterdomain(err)
+		}
+		return status.Removed, nil
+	}
+
+	if err := mesh.preflight(opID, version, namespace, forwarder, kubeconfigs); err != nil {
+		return st, err
+	}
+
+	err = forEachCluster(clusters, func(c *interdomainCluster) error {
+		values := interdomainValues(profile, c.Domain, federatedDomains(clusters, c))
+		return mesh.applyRecordedHelmChart(ctx, c.Name, c.Config, internalconfig.NSMChart, version, namespace, values, false)
+	})
+	if err != nil {
+		return st, ErrApplyHelmChart(err)
+	}
+
+	if report := dryRunFrom(ctx); report != nil {
+		for _, c := range clusters {
+			report.record(plannedInterdomainChanges(c, false)...)
+		}
+		return status.Installed, nil
+	}
+
+	if err := forEachCluster(clusters, exposeClusterDNS); err != nil {
+		return st, ErrInterdomain(err)
+	}
+	if err := forEachCluster(clusters, func(c *interdomainCluster) error {
+		return configureClusterDNS(c, clusters)
+	}); err != nil {
+		return st, ErrInterdomain(err)
+	}
+
+	if err := forEachCluster(clusters, func(c *interdomainCluster) error {
+		return fetchTrustBundle(c, namespace)
+	}); err != nil {
+		return st, ErrInterdomain(err)
+	}
+	if err := forEachCluster(clusters, func(c *interdomainCluster) error {
+		return setTrustBundles(c, namespace, clusters)
+	}); err != nil {
+		return st, ErrInterdomain(err)
+	}
+
+	return status.Installed, nil
+}
+
+// newInterdomainClusters creates the clients for each of the clusters of the
+// interdomain topology
+func newInterdomainClusters(kubeconfigs []string) ([]*interdomainCluster, error) {
+	clusters := make([]*interdomainCluster, 0, len(kubeconfigs))
+	for i, config := range kubeconfigs {
+		kClient, err := mesherykube.New([]byte(config))
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, &interdomainCluster{
+			Name:   clusterName(i),
+			Domain: interdomainDomain(i),
+			Config: config,
+			Client: kClient,
+		})
+	}
+	return clusters, nil
+}
+
+// teardownInterdomain removes the DNS wiring between the clusters and
+// uninstalls NSM from each of them
+func (mesh *Mesh) teardownInterdomain(ctx context.Context, version, namespace string, clusters []*interdomainCluster) error {
+	if report := dryRunFrom(ctx); report != nil {
+		for _, c := range clusters {
+			report.record(plannedInterdomainChanges(c, true)...)
+		}
+	} else if err := forEachCluster(clusters, unconfigureClusterDNS); err != nil {
+		return err
+	}
+	return forEachCluster(clusters, func(c *interdomainCluster) error {
+		return mesh.applyRecordedHelmChart(ctx, c.Name, c.Config, internalconfig.NSMChart, version, namespace, nil, true)
+	})
+}
+
+// plannedInterdomainChanges returns the changes made to the cluster by the
+// interdomain wiring or its teardown, reported by dry-run operations
+func plannedInterdomainChanges(c *interdomainCluster, del bool) []plannedChange {
+	service := fmt.Sprintf("Service/%s/%s", metav1.NamespaceSystem, exposedDNSService)
+	corefile := fmt.Sprintf("ConfigMap/%s/%s", metav1.NamespaceSystem, coreDNSConfigMap)
+	if del {
+		return []plannedChange{
+			{Cluster: c.Name, Action: plannedDelete, Object: service},
+			{Cluster: c.Name, Action: plannedConfigure, Object: corefile},
+		}
+	}
+	return []plannedChange{
+		{Cluster: c.Name, Action: plannedCreate, Object: service},
+		{Cluster: c.Name, Action: plannedConfigure, Object: corefile},
+		{Cluster: c.Name, Action: plannedRun, Object: "spire-server bundle set"},
+	}
+}
+
+// forEachCluster runs fn for each of the clusters concurrently and merges the errors
+func forEachCluster(clusters []*interdomainCluster, fn func(*interdomainCluster) error) error {
+	var wg sync.WaitGroup
+	var errs []error
+	var errMx sync.Mutex
+	for _, c := range clusters {
+		wg.Add(1)
+		go func(c *interdomainCluster) {
+			defer wg.Done()
+			if err := fn(c); err != nil {
+				errMx.Lock()
+				errs = append(errs, fmt.Errorf("%s: %s", c.Domain, err))
+				errMx.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return mergeErrors(errs)
+	}
+	return nil
+}
+
+// federatedDomains returns the domains of all of the clusters other than c
+func federatedDomains(clusters []*interdomainCluster, c *interdomainCluster) []string {
+	var domains []string
+	for _, other := range clusters {
+		if other != c {
+			domains = append(domains, other.Domain)
+		}
+	}
+	return domains
+}
+
+// interdomainValues returns the chart values which enable the interdomain
+// components of NSM along with SPIRE federation for the domain
+func interdomainValues(profile forwarderProfile, domain string, federatesWith []string) map[string]interface{} {
+	values := make(map[string]interface{})
+	for k, v := range profile.Values {
+		values[k] = v
+	}
+
+	values["interdomain"] = map[string]interface{}{
+		"enabled": true,
+		"domain":  domain,
+		"nsmgrProxy": map[string]interface{}{
+			"enabled": true,
+		},
+		"registryProxy": map[string]interface{}{
+			"enabled": true,
+		},
+	}
+	values["spire"] = map[string]interface{}{
+		"enabled":       true,
+		"trustDomain":   domain,
+		"federatesWith": federatesWith,
+	}
+	return values
+}
+
+// exposeClusterDNS exposes the cluster DNS through a load balancer service
+// and records its external address
+func exposeClusterDNS(c *interdomainCluster) error {
+	services := c.Client.KubeClient.CoreV1().Services(metav1.NamespaceSystem)
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: exposedDNSService,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeLoadBalancer,
+			Selector: map[string]string{"k8s-app": "kube-dns"},
+			Ports: []corev1.ServicePort{{
+				Name:       "dns",
+				Protocol:   corev1.ProtocolUDP,
+				Port:       53,
+				TargetPort: intstr.FromInt(53),
+			}},
+		},
+	}
+	if _, err := services.Create(context.TODO(), svc, metav1.CreateOptions{}); err != nil && !kubeerror.IsAlreadyExists(err) {
+		return err
+	}
+
+	return wait.PollImmediate(5*time.Second, loadBalancerTimeout, func() (bool, error) {
+		svc, err := services.Get(context.TODO(), exposedDNSService, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				c.DNSAddr = ingress.IP
+				return true, nil
+			}
+			if ingress.Hostname != "" {
+				c.DNSAddr = ingress.Hostname
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+// configureClusterDNS configures CoreDNS of the cluster to forward the
+// queries for the domains of the other clusters to their exposed DNS
+func configureClusterDNS(c *interdomainCluster, clusters []*interdomainCluster) error {
+	var blocks []string
+	for _, other := range clusters {
+		if other == c {
+			continue
+		}
+		blocks = append(blocks, fmt.Sprintf("%s:53 {\n    forward . %s\n}", other.Domain, other.DNSAddr))
+	}
+
+	return updateCorefile(c, func(corefile string) string {
+		corefile = interdomainDNSBlock.ReplaceAllString(corefile, "\n")
+		return fmt.Sprintf("%s\n%s\n%s\n%s\n", strings.TrimRight(corefile, "\n"), interdomainDNSBegin, strings.Join(blocks, "\n"), interdomainDNSEnd)
+	})
+}
+
+// unconfigureClusterDNS removes the forwarding configured by configureClusterDNS
+// along with the exposed DNS service
+func unconfigureClusterDNS(c *interdomainCluster) error {
+	err := updateCorefile(c, func(corefile string) string {
+		return interdomainDNSBlock.ReplaceAllString(corefile, "\n")
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Client.KubeClient.CoreV1().Services(metav1.NamespaceSystem).Delete(context.TODO(), exposedDNSService, metav1.DeleteOptions{})
+	if err != nil && !kubeerror.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// updateCorefile applies fn to the Corefile of the cluster
+func updateCorefile(c *interdomainCluster, fn func(string) string) error {
+	configMaps := c.Client.KubeClient.CoreV1().ConfigMaps(metav1.NamespaceSystem)
+	cm, err := configMaps.Get(context.TODO(), coreDNSConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data["Corefile"] = fn(cm.Data["Corefile"])
+	_, err = configMaps.Update(context.TODO(), cm, metav1.UpdateOptions{})
+	return err
+}
+
+// fetchTrustBundle fetches the SPIRE trust bundle of the cluster
+func fetchTrustBundle(c *interdomainCluster, namespace string) error {
+	pod, err := findRunningPod(c.Client, namespace, spireServerSelector)
+	if err != nil {
+		return err
+	}
+
+	bundle, err := execInPod(c.Client, namespace, pod, spireServerContainer, []string{"/opt/spire/bin/spire-server", "bundle", "show", "-format", "spiffe"}, nil)
+	if err != nil {
+		return err
+	}
+	c.Bundle = bundle
+	return nil
+}
+
+// setTrustBundles sets the trust bundles of the other clusters on the
+// SPIRE server of the cluster so that their identities are trusted
+func setTrustBundles(c *interdomainCluster, namespace string, clusters []*interdomainCluster) error {
+	pod, err := findRunningPod(c.Client, namespace, spireServerSelector)
+	if err != nil {
+		return err
+	}
+
+	for _, other := range clusters {
+		if other == c {
+			continue
+		}
+		_, err := execInPod(c.Client, namespace, pod, spireServerContainer, []string{
+			"/opt/spire/bin/spire-server", "bundle", "set", "-format", "spiffe", "-id", fmt.Sprintf("spiffe://%s", other.Domain),
+		}, strings.NewReader(other.Bundle))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,450 @@
+package nsm
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	internalconfig "github.com/layer5io/meshery-nsm/internal/config"
+	"github.com/layer5io/meshkit/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// journalSucceeded marks an operation which completed successfully
+	journalSucceeded = "succeeded"
+	// journalFailed marks an operation which failed
+	journalFailed = "failed"
+	// journalRunning marks an operation which has not completed yet
+	journalRunning = "running"
+
+	// journalDefaultLimit is the number of operations returned when
+	// the history is queried without a limit
+	journalDefaultLimit = 50
+
+	// journalMaxOperations is the number of operations kept in the
+	// journal, the oldest ones are pruned as new ones start
+	journalMaxOperations = 1000
+)
+
+var (
+	operationsBucket = []byte("operations")
+	installsBucket   = []byte("installs")
+)
+
+// journalOperation is the record of an operation requested to the adapter
+type journalOperation struct {
+	ID         string                 `json:"id"`
+	Operation  string                 `json:"operation"`
+	Version    string                 `json:"version,omitempty"`
+	Namespace  string                 `json:"namespace"`
+	Clusters   []string               `json:"clusters"`
+	Values     map[string]interface{} `json:"values,omitempty"`
+	Delete     bool                   `json:"delete"`
+	Outcome    string                 `json:"outcome"`
+	Error      string                 `json:"error,omitempty"`
+	StartedAt  time.Time              `json:"startedAt"`
+	FinishedAt *time.Time             `json:"finishedAt,omitempty"`
+}
+
+// journalInstall is the record of a helm chart installed on a cluster
+type journalInstall struct {
+	Cluster     string                 `json:"cluster"`
+	Namespace   string                 `json:"namespace"`
+	Chart       string                 `json:"chart"`
+	Version     string                 `json:"version"`
+	Values      map[string]interface{} `json:"values,omitempty"`
+	InstalledAt time.Time              `json:"installedAt"`
+	// Config is the kubeconfig of the cluster, it is only stored when
+	// the journal keeps the kubeconfigs and never streamed
+	Config string `json:"config,omitempty"`
+}
+
+func installKey(cluster, namespace, chart string) []byte {
+	return []byte(strings.Join([]string{cluster, namespace, chart}, "/"))
+}
+
+// journal persists the operations and the installed charts across restarts
+// of the adapter. A nil journal records nothing
+type journal struct {
+	db *bolt.DB
+	// kubeconfigs stores the kubeconfigs of the clusters along with the
+	// installed charts
+	kubeconfigs bool
+}
+
+// openJournal opens the journal at the path, creating it if needed
+func openJournal(path string) (*journal, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, ErrJournal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(operationsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(installsBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, ErrJournal(err)
+	}
+	return &journal{db: db}, nil
+}
+
+// put stores the value encoded as JSON under the key of the bucket
+func (j *journal) put(bucket, key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ErrJournal(err)
+	}
+	err = j.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key, data)
+	})
+	if err != nil {
+		return ErrJournal(err)
+	}
+	return nil
+}
+
+// startOperation records the start of the operation
+func (j *journal) startOperation(op journalOperation) error {
+	if j == nil {
+		return nil
+	}
+	op.Outcome = journalRunning
+	op.StartedAt = time.Now()
+	if err := j.put(operationsBucket, []byte(op.ID), op); err != nil {
+		return err
+	}
+	return j.pruneOperations(journalMaxOperations)
+}
+
+// pruneOperations deletes the oldest operations beyond the newest limit ones
+func (j *journal) pruneOperations(limit int) error {
+	err := j.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(operationsBucket)
+		if b.Stats().KeyN <= limit {
+			return nil
+		}
+
+		type started struct {
+			key []byte
+			at  time.Time
+		}
+		var ops []started
+		err := b.ForEach(func(key, data []byte) error {
+			var op journalOperation
+			if err := json.Unmarshal(data, &op); err != nil {
+				return err
+			}
+			ops = append(ops, started{key: append([]byte(nil), key...), at: op.StartedAt})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(ops) <= limit {
+			return nil
+		}
+
+		sort.Slice(ops, func(i, k int) bool {
+			return ops[i].at.After(ops[k].at)
+		})
+		for _, op := range ops[limit:] {
+			if err := b.Delete(op.key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrJournal(err)
+	}
+	return nil
+}
+
+// errorMessage returns the message of the error recorded in the journal.
+// Error() only returns the long description of meshkit errors, which many
+// of them leave empty, so their short description is recorded as well
+func errorMessage(err error) string {
+	e, ok := errors.Is(err)
+	if !ok {
+		return err.Error()
+	}
+	short := strings.Join(strings.Fields(strings.Join(e.ShortDescription, " ")), " ")
+	long := e.Error()
+	switch {
+	case short == "":
+		return long
+	case long == "":
+		return short
+	}
+	return short + ": " + long
+}
+
+// finishOperation records the outcome of the operation. A failed
+// operation stays failed even if it completes afterwards
+func (j *journal) finishOperation(id string, opErr error) error {
+	if j == nil {
+		return nil
+	}
+	err := j.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(operationsBucket)
+		data := b.Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		var op journalOperation
+		if err := json.Unmarshal(data, &op); err != nil {
+			return err
+		}
+		if op.Outcome == journalFailed {
+			return nil
+		}
+
+		now := time.Now()
+		op.FinishedAt = &now
+		op.Outcome = journalSucceeded
+		if opErr != nil {
+			op.Outcome = journalFailed
+			op.Error = errorMessage(opErr)
+		}
+		data, err := json.Marshal(op)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), data)
+	})
+	if err != nil {
+		return ErrJournal(err)
+	}
+	return nil
+}
+
+// operations returns the most recent operations, newest first
+func (j *journal) operations(limit int) ([]journalOperation, error) {
+	if j == nil {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = journalDefaultLimit
+	}
+
+	var ops []journalOperation
+	err := j.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(operationsBucket).ForEach(func(_, data []byte) error {
+			var op journalOperation
+			if err := json.Unmarshal(data, &op); err != nil {
+				return err
+			}
+			ops = append(ops, op)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, ErrJournal(err)
+	}
+
+	sort.Slice(ops, func(i, k int) bool {
+		return ops[i].StartedAt.After(ops[k].StartedAt)
+	})
+	if len(ops) > limit {
+		ops = ops[:limit]
+	}
+	return ops, nil
+}
+
+// recordInstall records the chart installed on the cluster, or removes
+// the record after the chart is uninstalled
+func (j *journal) recordInstall(install journalInstall, isDel bool) error {
+	if j == nil {
+		return nil
+	}
+	key := installKey(install.Cluster, install.Namespace, install.Chart)
+	if isDel {
+		err := j.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(installsBucket).Delete(key)
+		})
+		if err != nil {
+			return ErrJournal(err)
+		}
+		return nil
+	}
+	install.InstalledAt = time.Now()
+	if !j.kubeconfigs {
+		install.Config = ""
+	}
+	return j.put(installsBucket, key, install)
+}
+
+// storeKubeconfigs sets whether the kubeconfigs are stored along with the
+// installed charts. When they are not, the ones stored before are removed
+func (j *journal) storeKubeconfigs(enabled bool) error {
+	if j == nil {
+		return nil
+	}
+	j.kubeconfigs = enabled
+	if enabled {
+		return nil
+	}
+	err := j.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(installsBucket)
+		updated := make(map[string][]byte)
+		err := b.ForEach(func(key, data []byte) error {
+			var install journalInstall
+			if err := json.Unmarshal(data, &install); err != nil {
+				return err
+			}
+			if install.Config == "" {
+				return nil
+			}
+			install.Config = ""
+			data, err := json.Marshal(install)
+			if err != nil {
+				return err
+			}
+			updated[string(key)] = data
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for key, data := range updated {
+			if err := b.Put([]byte(key), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrJournal(err)
+	}
+	return nil
+}
+
+// install returns the record of the chart installed on the cluster
+func (j *journal) install(cluster, namespace, chart string) (*journalInstall, error) {
+	if j == nil {
+		return nil, nil
+	}
+	var install *journalInstall
+	err := j.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(installsBucket).Get(installKey(cluster, namespace, chart))
+		if data == nil {
+			return nil
+		}
+		install = &journalInstall{}
+		return json.Unmarshal(data, install)
+	})
+	if err != nil {
+		return nil, ErrJournal(err)
+	}
+	return install, nil
+}
+
+// installs returns the records of all of the installed charts
+func (j *journal) installs() ([]journalInstall, error) {
+	if j == nil {
+		return nil, nil
+	}
+	var installs []journalInstall
+	err := j.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(installsBucket).ForEach(func(_, data []byte) error {
+			var install journalInstall
+			if err := json.Unmarshal(data, &install); err != nil {
+				return err
+			}
+			installs = append(installs, install)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, ErrJournal(err)
+	}
+	return installs, nil
+}
+
+// journalHistory is the state of the journal streamed to Meshery
+type journalHistory struct {
+	Installs   []journalInstall   `json:"installs"`
+	Operations []journalOperation `json:"operations"`
+}
+
+// history returns the installed charts, without their kubeconfigs, and
+// the most recent operations
+func (j *journal) history(limit int) (*journalHistory, error) {
+	installs, err := j.installs()
+	if err != nil {
+		return nil, err
+	}
+	for i := range installs {
+		installs[i].Config = ""
+	}
+	ops, err := j.operations(limit)
+	if err != nil {
+		return nil, err
+	}
+	return &journalHistory{Installs: installs, Operations: ops}, nil
+}
+
+// JournalKubeconfigs sets whether the journal stores the kubeconfigs of the
+// clusters NSM is installed on, for the reconciler to keep watching them
+// across restarts of the adapter. The kubeconfigs are credentials to the
+// clusters and are stored in plaintext, so they are only stored when
+// enabled and the ones stored before are removed when disabled
+func (mesh *Mesh) JournalKubeconfigs(enabled bool) {
+	if err := mesh.journal.storeKubeconfigs(enabled); err != nil {
+		mesh.Log.Warn(err)
+	}
+	if !enabled {
+		return
+	}
+
+	// Restore the targets of the reconciler installed before the restart
+	installs, err := mesh.journal.installs()
+	if err != nil {
+		mesh.Log.Warn(err)
+	}
+	for _, install := range installs {
+		if install.Chart == internalconfig.NSMChart && install.Config != "" {
+			mesh.targets.track(install.Cluster, install.Namespace, install.Config, false)
+		}
+	}
+}
+
+// journalStart records the start of the requested operation
+func (mesh *Mesh) journalStart(opReq adapter.OperationRequest, version string, opts *operationOptions) {
+	clusters := make([]string, 0, len(opReq.K8sConfigs))
+	for i, config := range opReq.K8sConfigs {
+		clusters = append(clusters, kubeContextName(config, clusterName(i)))
+	}
+
+	var values map[string]interface{}
+	if data, err := json.Marshal(opts); err == nil {
+		_ = json.Unmarshal(data, &values)
+	}
+
+	err := mesh.journal.startOperation(journalOperation{
+		ID:        opReq.OperationID,
+		Operation: opReq.OperationName,
+		Version:   version,
+		Namespace: opReq.Namespace,
+		Clusters:  clusters,
+		Values:    values,
+		Delete:    opReq.IsDeleteOperation,
+	})
+	if err != nil {
+		mesh.Log.Warn(err)
+	}
+}
+
+// journalFinish records the outcome of the operation
+func (mesh *Mesh) journalFinish(id string, opErr error) {
+	if err := mesh.journal.finishOperation(id, opErr); err != nil {
+		mesh.Log.Warn(err)
+	}
+}
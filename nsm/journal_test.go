@@ -0,0 +1,37 @@
+package nsm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "details in the short description",
+			err:  ErrInstallNSM(fmt.Errorf("chart not found")),
+			want: "Error with nsm operation: chart not found",
+		},
+		{
+			name: "details in the long description",
+			err:  ErrVL3Network(fmt.Errorf("replica count must be at least 1, got 0")),
+			want: "Error with vL3 network operation: replica count must be at least 1, got 0",
+		},
+		{
+			name: "raw error",
+			err:  fmt.Errorf("connection refused"),
+			want: "connection refused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorMessage(tt.err); got != tt.want {
+				t.Errorf("errorMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
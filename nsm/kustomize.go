@@ -0,0 +1,152 @@
+package nsm
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// maxKustomizationSize is the maximum size of the files of a kustomization
+// once extracted from its archive
+const maxKustomizationSize = 16 << 20
+
+// kustomizeOptions is a kustomization built in place of the manifest of a
+// custom operation. The files are either passed inline or as an archive,
+// when both are passed the inline files override the ones of the archive
+type kustomizeOptions struct {
+	// Path is the directory of the kustomization to build, relative to
+	// the root of the files. It defaults to the root
+	Path string `json:"path,omitempty"`
+
+	// Files are the contents of the files keyed by their path
+	Files map[string]string `json:"files,omitempty"`
+
+	// Archive is a tar, tar.gz or zip archive of the files, encoded
+	// in base64
+	Archive []byte `json:"archive,omitempty"`
+}
+
+// buildKustomization builds the kustomization in memory and returns the
+// resulting manifest
+func buildKustomization(opts *kustomizeOptions) (string, error) {
+	fs := filesys.MakeFsInMemory()
+
+	if len(opts.Archive) != 0 {
+		if err := extractArchive(fs, opts.Archive); err != nil {
+			return "", ErrKustomize(err)
+		}
+	}
+	for name, contents := range opts.Files {
+		p, err := kustomizationPath(name)
+		if err != nil {
+			return "", ErrKustomize(err)
+		}
+		if err := fs.WriteFile(p, []byte(contents)); err != nil {
+			return "", ErrKustomize(err)
+		}
+	}
+
+	dir, err := kustomizationPath(opts.Path)
+	if err != nil {
+		return "", ErrKustomize(err)
+	}
+	resources, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fs, dir)
+	if err != nil {
+		return "", ErrKustomize(err)
+	}
+	manifest, err := resources.AsYaml()
+	if err != nil {
+		return "", ErrKustomize(err)
+	}
+	return string(manifest), nil
+}
+
+// kustomizationPath returns the absolute path of the file in the in memory
+// file system, paths escaping the root are rejected
+func kustomizationPath(name string) (string, error) {
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("invalid path %s", name)
+		}
+	}
+	return path.Clean("/" + name), nil
+}
+
+// extractArchive extracts the tar, tar.gz or zip archive into the file system
+func extractArchive(fs filesys.FileSystem, archive []byte) error {
+	var size int64
+	write := func(name string, r io.Reader) error {
+		p, err := kustomizationPath(name)
+		if err != nil {
+			return err
+		}
+		contents, err := io.ReadAll(io.LimitReader(r, maxKustomizationSize-size+1))
+		if err != nil {
+			return err
+		}
+		size += int64(len(contents))
+		if size > maxKustomizationSize {
+			return fmt.Errorf("archive exceeds %d bytes", maxKustomizationSize)
+		}
+		return fs.WriteFile(p, contents)
+	}
+
+	switch {
+	case bytes.HasPrefix(archive, []byte("PK\x03\x04")):
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = write(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case bytes.HasPrefix(archive, []byte{0x1f, 0x8b}):
+		gr, err := gzip.NewReader(bytes.NewReader(archive))
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		return extractTar(tar.NewReader(gr), write)
+	default:
+		return extractTar(tar.NewReader(bytes.NewReader(archive)), write)
+	}
+}
+
+// extractTar writes each of the regular files of the tar archive
+func extractTar(tr *tar.Reader, write func(string, io.Reader) error) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := write(hdr.Name, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package nsm
+
+import "testing"
+
+func TestKustomizationPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "root", path: "", want: "/"},
+		{name: "relative", path: "overlays/prod", want: "/overlays/prod"},
+		{name: "absolute", path: "/base/kustomization.yaml", want: "/base/kustomization.yaml"},
+		{name: "cleaned", path: "base/./patches//", want: "/base/patches"},
+		{name: "parent", path: "../secrets", wantErr: true},
+		{name: "nested parent", path: "base/../../secrets", wantErr: true},
+		{name: "dots in names", path: "base/..patch.yaml", want: "/base/..patch.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := kustomizationPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("kustomizationPath(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("kustomizationPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
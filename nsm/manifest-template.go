@@ -0,0 +1,59 @@
+package nsm
+
+import (
+	"bytes"
+	"context"
+	"text/template"
+)
+
+// manifestVars are the variables available to the Go templates of the
+// custom operation and sample app manifests, which are only rendered when
+// the operation sets the template option:
+//
+//	{{ .Namespace }}   the namespace of the operation
+//	{{ .Cluster }}     the name of the cluster the manifest is applied to
+//	{{ .NSMVersion }}  the version of NSM installed by the adapter
+//	{{ .Registry }}    the registry of the NSM images
+//	{{ .Params.key }}  the parameters passed with the operation
+//
+// Referencing a parameter which is not passed fails the operation
+type manifestVars struct {
+	Namespace  string
+	Cluster    string
+	NSMVersion string
+	Registry   string
+	Params     map[string]string
+}
+
+type manifestVarsKey struct{}
+
+// withManifestVars returns a context which renders the manifests of the
+// operation as templates of the variables
+func withManifestVars(ctx context.Context, vars manifestVars) context.Context {
+	return context.WithValue(ctx, manifestVarsKey{}, vars)
+}
+
+// manifestVarsFrom returns the variables of the manifest templates of the
+// operation, false if the manifests are not templates
+func manifestVarsFrom(ctx context.Context) (manifestVars, bool) {
+	vars, ok := ctx.Value(manifestVarsKey{}).(manifestVars)
+	return vars, ok
+}
+
+// renderManifest renders the manifest template for the cluster
+func renderManifest(contents []byte, vars manifestVars, cluster string) ([]byte, error) {
+	tmpl, err := template.New("manifest").Option("missingkey=error").Parse(string(contents))
+	if err != nil {
+		return nil, ErrRenderManifest(err)
+	}
+
+	vars.Cluster = cluster
+	if vars.Params == nil {
+		vars.Params = map[string]string{}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return nil, ErrRenderManifest(err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,424 @@
+package nsm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// meshProxyImageTag is the tag of the mesh proxy NSE image
+	meshProxyImageTag = "v1.6.1"
+
+	// meshProxyTimeout is the time to wait for the mesh proxy NSE to
+	// become ready after it joined the mesh
+	meshProxyTimeout = 5 * time.Minute
+
+	// defaultMeshProxyCIDR is the address range the mesh proxy NSE hands
+	// out to its clients, it is taken from the shared address space to
+	// stay clear of the pod, service and Docker bridge networks
+	defaultMeshProxyCIDR = "100.64.0.0/24"
+)
+
+// meshIntegration describes how NSM is integrated with a service mesh
+type meshIntegration struct {
+	// Name is the name of the service mesh
+	Name string
+	// ControlPlaneNamespace and ControlPlaneDeployment identify the
+	// control plane which has to be present before the integration
+	ControlPlaneNamespace  string
+	ControlPlaneDeployment string
+	// InjectAnnotation and InjectValue enable the sidecar injection on a pod
+	InjectAnnotation string
+	InjectValue      string
+	// SidecarContainer is the name of the injected sidecar container
+	SidecarContainer string
+	// ProxyImage is the image of the proxy NSE, without its tag
+	ProxyImage string
+}
+
+// meshIntegrations maps the service mesh names to their integration. Only
+// the meshes NSM provides a proxy NSE for are integrated, which leaves
+// Kuma out until NSM provides one for it
+var meshIntegrations = map[string]meshIntegration{
+	"istio": {
+		Name:                   "istio",
+		ControlPlaneNamespace:  "istio-system",
+		ControlPlaneDeployment: "istiod",
+		InjectAnnotation:       "sidecar.istio.io/inject",
+		InjectValue:            "true",
+		SidecarContainer:       "istio-proxy",
+		ProxyImage:             "ghcr.io/networkservicemesh/cmd-nse-istio-proxy-native",
+	},
+}
+
+// meshProxyTemplate is the manifest of the integration components: the
+// network service of the mesh, the proxy NSE which joins the mesh and
+// forwards the traffic of the NSM clients into it, and the DNS server
+// which resolves the names of the mesh services for the NSM clients
+var meshProxyTemplate = template.Must(template.New("mesh-proxy").Parse(`---
+apiVersion: networkservicemesh.io/v1
+kind: NetworkService
+metadata:
+  name: {{ .Name }}-proxy
+spec:
+  payload: IP
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Name }}-proxy-nse
+  labels:
+    app: {{ .Name }}-proxy-nse
+spec:
+  selector:
+    matchLabels:
+      app: {{ .Name }}-proxy-nse
+  template:
+    metadata:
+      labels:
+        app: {{ .Name }}-proxy-nse
+      annotations:
+        {{ .InjectAnnotation }}: "{{ .InjectValue }}"
+    spec:
+      containers:
+        - name: nse
+          image: {{ .Image }}
+          imagePullPolicy: IfNotPresent
+          securityContext:
+            privileged: true
+          env:
+            - name: NSM_SERVICE_NAMES
+              value: {{ .Name }}-proxy
+            - name: NSM_CIDR_PREFIX
+              value: {{ .CIDR }}
+            - name: NSM_NAME
+              valueFrom:
+                fieldRef:
+                  fieldPath: metadata.name
+            - name: SPIFFE_ENDPOINT_SOCKET
+              value: unix:///run/spire/sockets/agent.sock
+            - name: NSM_CONNECT_TO
+              value: unix:///var/lib/networkservicemesh/nsm.io.sock
+          volumeMounts:
+            - name: spire-agent-socket
+              mountPath: /run/spire/sockets
+              readOnly: true
+            - name: nsm-socket
+              mountPath: /var/lib/networkservicemesh
+              readOnly: true
+        - name: dns
+          image: coredns/coredns:1.8.6
+          imagePullPolicy: IfNotPresent
+          args: ["-conf", "/etc/coredns/Corefile"]
+          volumeMounts:
+            - name: dns-config
+              mountPath: /etc/coredns
+              readOnly: true
+      volumes:
+        - name: spire-agent-socket
+          hostPath:
+            path: /run/spire/sockets
+            type: Directory
+        - name: nsm-socket
+          hostPath:
+            path: /var/lib/networkservicemesh
+            type: DirectoryOrCreate
+        - name: dns-config
+          configMap:
+            name: {{ .Name }}-proxy-dns
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}-proxy-dns
+data:
+  Corefile: |
+    .:53 {
+        forward . /etc/resolv.conf
+        cache 30
+    }
+`))
+
+// meshProxyCheckTemplate is the manifest of the NSM client which verifies
+// that traffic flows through the proxy NSE into the mesh
+var meshProxyCheckTemplate = template.Must(template.New("mesh-proxy-check").Parse(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Name }}-proxy-check
+  labels:
+    app: {{ .Name }}-proxy-check
+spec:
+  selector:
+    matchLabels:
+      app: {{ .Name }}-proxy-check
+  template:
+    metadata:
+      labels:
+        app: {{ .Name }}-proxy-check
+      annotations:
+        networkservicemesh.io: kernel://{{ .Name }}-proxy/nsm-1
+    spec:
+      containers:
+        - name: client
+          image: {{ .TestImage }}
+          imagePullPolicy: IfNotPresent
+          command: ["sleep", "infinity"]
+          securityContext:
+            capabilities:
+              add: ["NET_RAW"]
+`))
+
+// meshProxy holds the values of the mesh proxy templates
+type meshProxy struct {
+	meshIntegration
+	Image     string
+	CIDR      string
+	TestImage string
+}
+
+// meshProxyOptions are the options of the proxy NSE of a service mesh
+// integration
+type meshProxyOptions struct {
+	// Image is the image of the proxy NSE, it defaults to the proxy NSE
+	// of the service mesh provided by NSM
+	Image string `json:"image,omitempty"`
+	// CIDR is the address range the proxy NSE hands out to its clients
+	CIDR string `json:"cidr,omitempty"`
+	// TestImage is the image of the client verifying the traffic through
+	// the proxy NSE
+	TestImage string `json:"testImage,omitempty"`
+}
+
+// newMeshProxy returns the values of the mesh proxy templates of the
+// integration
+func newMeshProxy(integration meshIntegration, opts meshProxyOptions) (meshProxy, error) {
+	proxy := meshProxy{
+		meshIntegration: integration,
+		Image:           opts.Image,
+		CIDR:            opts.CIDR,
+		TestImage:       opts.TestImage,
+	}
+	if proxy.Image == "" {
+		proxy.Image = integration.ProxyImage + ":" + meshProxyImageTag
+	}
+	if proxy.CIDR == "" {
+		proxy.CIDR = defaultMeshProxyCIDR
+	}
+	if _, _, err := net.ParseCIDR(proxy.CIDR); err != nil {
+		return proxy, err
+	}
+	return proxy, nil
+}
+
+// getMeshIntegration returns the integration of the named service mesh
+func getMeshIntegration(name string) (meshIntegration, error) {
+	integration, ok := meshIntegrations[name]
+	if !ok {
+		return meshIntegration{}, ErrMeshIntegration(fmt.Errorf("unsupported service mesh: %s", name))
+	}
+	return integration, nil
+}
+
+// installMeshIntegration installs NSM alongside the service mesh control plane
+// present on each of the clusters, deploys the integration components and
+// verifies that they joined the mesh. If skipInstall is set NSM is expected
+// to be installed already and only the integration components are handled
+func (mesh *Mesh) installMeshIntegration(ctx context.Context, opID string, del bool, version, namespace, forwarder string, skipInstall bool, integration meshIntegration, opts meshProxyOptions, kubeconfigs []string) (string, error) {
+	st := status.Installing
+	if del {
+		st = status.Removing
+	}
+
+	proxy, err := newMeshProxy(integration, opts)
+	if err != nil && !del {
+		return st, ErrMeshIntegration(err)
+	}
+	var manifest bytes.Buffer
+	if err := meshProxyTemplate.Execute(&manifest, proxy); err != nil {
+		return st, ErrMeshIntegration(err)
+	}
+
+	if del {
+		if err := mesh.applyManifest(ctx, manifest.Bytes(), true, namespace, kubeconfigs); err != nil {
+			return st, ErrMeshIntegration(err)
+		}
+		if !skipInstall {
+			if _, err := mesh.installNSMMesh(ctx, opID, true, version, namespace, forwarder, kubeconfigs); err != nil {
+				return st, err
+			}
+		}
+		return status.Removed, nil
+	}
+
+	if err := forEachKubeconfig(kubeconfigs, func(_, _ string, kClient *mesherykube.Client) error {
+		return checkControlPlane(kClient, integration)
+	}); err != nil {
+		return st, ErrMeshIntegration(err)
+	}
+
+	if !skipInstall {
+		if _, err := mesh.installNSMMesh(ctx, opID, false, version, namespace, forwarder, kubeconfigs); err != nil {
+			return st, err
+		}
+	}
+
+	if err := mesh.applyManifest(ctx, manifest.Bytes(), false, namespace, kubeconfigs); err != nil {
+		return st, ErrMeshIntegration(err)
+	}
+
+	// The proxy NSE is not deployed by dry-run operations
+	if report := dryRunFrom(ctx); report != nil {
+		for i := range kubeconfigs {
+			report.record(plannedChange{Cluster: clusterName(i), Action: plannedRun, Object: fmt.Sprintf("%s proxy traffic check", integration.Name)})
+		}
+		return status.Installed, nil
+	}
+
+	if err := forEachKubeconfig(kubeconfigs, func(cluster, config string, kClient *mesherykube.Client) error {
+		return mesh.verifyMeshProxy(ctx, cluster, config, kClient, namespace, proxy)
+	}); err != nil {
+		return st, ErrMeshIntegration(err)
+	}
+
+	return status.Installed, nil
+}
+
+// forEachKubeconfig creates a client for each of the kubeconfigs and runs fn
+// with it concurrently, the errors are prefixed with the cluster name
+func forEachKubeconfig(kubeconfigs []string, fn func(cluster, config string, kClient *mesherykube.Client) error) error {
+	var wg sync.WaitGroup
+	var errs []error
+	var errMx sync.Mutex
+	for i, config := range kubeconfigs {
+		wg.Add(1)
+		go func(cluster, config string) {
+			defer wg.Done()
+			kClient, err := mesherykube.New([]byte(config))
+			if err == nil {
+				err = fn(cluster, config, kClient)
+			}
+			if err != nil {
+				errMx.Lock()
+				errs = append(errs, fmt.Errorf("%s: %s", cluster, err))
+				errMx.Unlock()
+			}
+		}(clusterName(i), config)
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return mergeErrors(errs)
+	}
+	return nil
+}
+
+// checkControlPlane verifies that the control plane of the service mesh is
+// deployed and available on the cluster
+func checkControlPlane(kClient *mesherykube.Client, integration meshIntegration) error {
+	deployment, err := kClient.KubeClient.AppsV1().Deployments(integration.ControlPlaneNamespace).Get(context.TODO(), integration.ControlPlaneDeployment, metav1.GetOptions{})
+	if kubeerror.IsNotFound(err) {
+		return fmt.Errorf("%s control plane not found in namespace %s", integration.Name, integration.ControlPlaneNamespace)
+	}
+	if err != nil {
+		return err
+	}
+	if deployment.Status.AvailableReplicas == 0 {
+		return fmt.Errorf("%s control plane has no available replicas", integration.Name)
+	}
+	return nil
+}
+
+// verifyMeshProxy waits for the proxy NSE to become ready with the sidecar
+// of the service mesh injected, then connects a client to it and verifies
+// that the client reaches the proxy NSE over the NSM connection and
+// resolves the control plane service of the mesh through it
+func (mesh *Mesh) verifyMeshProxy(ctx context.Context, cluster, config string, kClient *mesherykube.Client, namespace string, proxy meshProxy) error {
+	if err := waitMeshSidecar(kClient, namespace, proxy.meshIntegration); err != nil {
+		return fmt.Errorf("%s sidecar of the proxy NSE not ready: %s", proxy.Name, err)
+	}
+
+	var manifest bytes.Buffer
+	if err := meshProxyCheckTemplate.Execute(&manifest, proxy); err != nil {
+		return err
+	}
+	if err := mesh.applyManifestToCluster(ctx, cluster, config, manifest.Bytes(), false, namespace); err != nil {
+		return err
+	}
+	defer func() {
+		if err := mesh.applyManifestToCluster(ctx, cluster, config, manifest.Bytes(), true, namespace); err != nil {
+			mesh.Log.Warn(ErrMeshIntegration(err))
+		}
+	}()
+
+	var pod, target string
+	var check connectivityCheck
+	err := wait.PollImmediate(5*time.Second, meshProxyTimeout, func() (bool, error) {
+		var err error
+		if pod, err = findRunningPod(kClient, namespace, "app="+proxy.Name+"-proxy-check"); err != nil {
+			return false, nil
+		}
+		exec := func(command ...string) (string, error) {
+			return execInPod(kClient, namespace, pod, "client", command, nil)
+		}
+		routes, err := exec("ip", "-4", "route", "show")
+		if err != nil {
+			return false, nil
+		}
+		if target = nseAddress(routes); target == "" {
+			return false, nil
+		}
+		out, err := exec("ping", "-c", strconv.Itoa(defaultPingCount), "-q", target)
+		check = pingCheck(out, err, 0)
+		return check.Passed, nil
+	})
+	if err != nil {
+		if target == "" {
+			return fmt.Errorf("client did not connect to the %s proxy NSE: %s", proxy.Name, err)
+		}
+		return fmt.Errorf("client did not reach the %s proxy NSE at %s: %d/%d replies", proxy.Name, target, check.Received, check.Transmitted)
+	}
+
+	// The DNS server of the proxy NSE resolves the names of the mesh
+	// services from the network namespace of the proxy
+	service := fmt.Sprintf("%s.%s.svc.cluster.local", proxy.ControlPlaneDeployment, proxy.ControlPlaneNamespace)
+	if _, err := execInPod(kClient, namespace, pod, "client", []string{"nslookup", service, target}, nil); err != nil {
+		return fmt.Errorf("client did not resolve %s through the %s proxy NSE: %s", service, proxy.Name, err)
+	}
+	return nil
+}
+
+// waitMeshSidecar waits for the proxy NSE to become ready with the sidecar
+// of the service mesh injected. The sidecar only becomes ready once it is
+// connected to the control plane
+func waitMeshSidecar(kClient *mesherykube.Client, namespace string, integration meshIntegration) error {
+	selector := fmt.Sprintf("app=%s-proxy-nse", integration.Name)
+	return wait.PollImmediate(5*time.Second, meshProxyTimeout, func() (bool, error) {
+		pods, err := kClient.KubeClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: selector,
+		})
+		if err != nil {
+			return false, err
+		}
+		for _, pod := range pods.Items {
+			for _, cs := range pod.Status.ContainerStatuses {
+				if cs.Name == integration.SidecarContainer && cs.Ready {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	})
+}
@@ -0,0 +1,46 @@
+package nsm
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// nsmImageTag returns the tag of the NSM images installed on the cluster,
+// read from the image of the NSM managers, so that the workloads deployed
+// by the adapter match the installed NSM. The fallback tag is returned
+// when no NSM manager is found
+func nsmImageTag(ctx context.Context, kClient *mesherykube.Client, fallback string) string {
+	daemonsets, err := kClient.KubeClient.AppsV1().DaemonSets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fallback
+	}
+	for _, d := range daemonsets.Items {
+		if !strings.Contains(d.Name, "nsmgr") {
+			continue
+		}
+		for _, c := range d.Spec.Template.Spec.Containers {
+			if tag := imageTag(c.Image, "cmd-nsmgr"); tag != "" {
+				return tag
+			}
+		}
+	}
+	return fallback
+}
+
+// imageTag returns the tag of the image if its repository is the named
+// one, empty otherwise
+func imageTag(image, repository string) string {
+	ref, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return ""
+	}
+	tagged, ok := ref.(reference.Tagged)
+	if !ok || !strings.HasSuffix(reference.Path(ref), "/"+repository) {
+		return ""
+	}
+	return tagged.Tag()
+}
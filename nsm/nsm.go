@@ -3,7 +3,11 @@ package nsm
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-adapter-library/common"
@@ -24,6 +28,18 @@ const (
 // Mesh represents the nsm-mesh adapter and embeds adapter.Adapter
 type Mesh struct {
 	adapter.Adapter // Type Embedded
+
+	// targets are the clusters and namespaces NSM was installed to
+	targets *reconcileTargets
+
+	// journal records the operations and the installed charts
+	journal *journal
+
+	// images rewrites the images of the applied charts and manifests
+	images *imageRewriter
+
+	// running are the operations whose outcome is not streamed yet
+	running sync.Map
 }
 
 // New initializes treafik-mesh handler.
@@ -32,14 +48,23 @@ func New(c adapterconfig.Handler,
 	kc adapterconfig.Handler,
 	ev *events.EventStreamer,
 ) adapter.Handler {
-	return &Mesh{
+	mesh := &Mesh{
 		Adapter: adapter.Adapter{
 			Config:            c,
 			KubeconfigHandler: kc,
 			Log:               l,
 			EventStreamer:     ev,
 		},
+		targets: newReconcileTargets(),
+	}
+
+	j, err := openJournal(internalconfig.JournalPath())
+	if err != nil {
+		l.Warn(err)
+		return mesh
 	}
+	mesh.journal = j
+	return mesh
 }
 
 // ApplyOperation applies the operation on nsm mesh
@@ -59,11 +84,59 @@ func (mesh *Mesh) ApplyOperation(ctx context.Context, opReq adapter.OperationReq
 		ComponentName: internalconfig.ServerConfig["name"],
 	}
 
+	opts, customBody, err := parseRequestOptions(opReq)
+	if err != nil {
+		mesh.streamErr("Error while parsing operation options", e, err)
+		return nil
+	}
+
+	var version string
+	if op, ok := operations[opReq.OperationName]; ok && len(op.Versions) != 0 && string(op.Versions[0]) != status.None {
+		version = string(op.Versions[0])
+	}
+	mesh.journalStart(opReq, version, opts)
+	ctx = mesh.operationStarted(ctx, opReq)
+
+	// The operations outlive the request, hence they must not be
+	// canceled along with its context
+	ctx = context.WithoutCancel(ctx)
+	if opts.DryRun {
+		ctx, _ = withDryRun(ctx)
+	}
+	ctx = withManifestApply(ctx, manifestApply{
+		Strict:         opts.strict(opReq.OperationName),
+		Rollback:       opts.Rollback,
+		ForceConflicts: opts.ForceConflicts,
+	})
+
+	// The manifests of custom operations and sample apps are rendered as
+	// templates when the operation asks for it
+	templateCtx := ctx
+	if opts.Template {
+		vars := manifestVars{
+			Namespace: opReq.Namespace,
+			Registry:  opts.Registry,
+			Params:    opts.Params,
+		}
+		if op, ok := operations[internalconfig.NSMMeshOperation]; ok {
+			if len(op.Versions) != 0 {
+				vars.NSMVersion = string(op.Versions[0])
+			}
+			if vars.Registry == "" {
+				vars.Registry = op.AdditionalProperties[internalconfig.ImageRegistry]
+			}
+		}
+		templateCtx = withManifestVars(ctx, vars)
+	}
+
 	switch opReq.OperationName {
 	case internalconfig.NSMMeshOperation:
 		go func(hh *Mesh, ee *meshes.EventsResponse) {
 			version := string(operations[opReq.OperationName].Versions[0])
-			stat, err := hh.installNSMMesh(opReq.IsDeleteOperation, version, opReq.Namespace, kubeConfigs)
+			if opts.Forwarder == "" {
+				opts.Forwarder = operations[opReq.OperationName].AdditionalProperties[internalconfig.Forwarder]
+			}
+			stat, err := hh.installNSMMesh(ctx, ee.OperationId, opReq.IsDeleteOperation, version, opReq.Namespace, opts.Forwarder, kubeConfigs)
 			if err != nil {
 				summary := fmt.Sprintf("Error while %s NSM service mesh", stat)
 				e.Details = err.Error()
@@ -72,12 +145,102 @@ func (mesh *Mesh) ApplyOperation(ctx context.Context, opReq adapter.OperationReq
 			}
 			ee.Summary = fmt.Sprintf("NSM service mesh %s successfully", stat)
 			ee.Details = fmt.Sprintf("The NSM service mesh is now %s.", stat)
-			hh.StreamInfo(e)
+			if !opReq.IsDeleteOperation && !opts.DryRun {
+				forwarders, err := hh.discoverForwarders(opReq.Namespace, kubeConfigs)
+				if err != nil {
+					hh.Log.Warn(err)
+				}
+				ee.Details = fmt.Sprintf("%s Running forwarders: %s.", ee.Details, forwardersSummary(forwarders))
+			}
+			hh.streamResult(ctx, e)
+		}(mesh, e)
+	case internalconfig.NSMInterdomainOperation:
+		go func(hh *Mesh, ee *meshes.EventsResponse) {
+			version := string(operations[opReq.OperationName].Versions[0])
+			if opts.Forwarder == "" {
+				opts.Forwarder = operations[opReq.OperationName].AdditionalProperties[internalconfig.Forwarder]
+			}
+			stat, err := hh.installInterdomain(ctx, ee.OperationId, opReq.IsDeleteOperation, version, opReq.Namespace, opts.Forwarder, kubeConfigs)
+			if err != nil {
+				summary := fmt.Sprintf("Error while %s NSM interdomain topology", stat)
+				hh.streamErr(summary, ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("NSM interdomain topology %s successfully", stat)
+			ee.Details = fmt.Sprintf("The NSM interdomain topology across %d clusters is now %s.", len(kubeConfigs), stat)
+			hh.streamResult(ctx, ee)
+		}(mesh, e)
+	case internalconfig.NSMFloatingRegistryOperation:
+		go func(hh *Mesh, ee *meshes.EventsResponse) {
+			version := string(operations[internalconfig.NSMInterdomainOperation].Versions[0])
+			if opts.Forwarder == "" {
+				opts.Forwarder = operations[opReq.OperationName].AdditionalProperties[internalconfig.Forwarder]
+			}
+			stat, err := hh.installFloatingRegistry(ctx, opReq.IsDeleteOperation, version, opReq.Namespace, opts.Forwarder, opts.FloatingCluster, kubeConfigs)
+			if err != nil {
+				summary := fmt.Sprintf("Error while %s NSM floating registry", stat)
+				hh.streamErr(summary, ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("NSM floating registry %s successfully", stat)
+			ee.Details = fmt.Sprintf("The NSM floating registry on %s is now %s.", clusterName(opts.FloatingCluster), stat)
+			hh.streamResult(ctx, ee)
+		}(mesh, e)
+	case internalconfig.NSMVL3NetworkOperation:
+		go func(hh *Mesh, ee *meshes.EventsResponse) {
+			props := operations[opReq.OperationName].AdditionalProperties
+			if opts.CIDR == "" {
+				opts.CIDR = props[internalconfig.VL3CIDR]
+			}
+			if opts.Replicas == 0 {
+				opts.Replicas, _ = strconv.Atoi(props[internalconfig.VL3Replicas])
+			}
+			stat, allocations, err := hh.deployVL3Network(ctx, opReq.IsDeleteOperation, props[common.ServiceName], opReq.Namespace, opts.CIDR, opts.Replicas, kubeConfigs)
+			if err != nil {
+				summary := fmt.Sprintf("Error while %s vL3 network", stat)
+				hh.streamErr(summary, ee, err)
+				return
+			}
+			details, err := json.Marshal(allocations)
+			if err != nil {
+				hh.streamErr("Error while encoding vL3 network prefixes", ee, ErrVL3Network(err))
+				return
+			}
+			ee.Summary = fmt.Sprintf("vL3 network %s successfully", stat)
+			ee.Details = string(details)
+			hh.streamResult(ctx, ee)
+		}(mesh, e)
+	case internalconfig.NSMIstioOperation:
+		go func(hh *Mesh, ee *meshes.EventsResponse) {
+			version := string(operations[opReq.OperationName].Versions[0])
+			props := operations[opReq.OperationName].AdditionalProperties
+			if opts.Forwarder == "" {
+				opts.Forwarder = props[internalconfig.Forwarder]
+			}
+			integration, err := getMeshIntegration(props[internalconfig.IntegratedMesh])
+			if err != nil {
+				hh.streamErr("Error while resolving service mesh integration", ee, err)
+				return
+			}
+			mpo := opts.MeshProxy
+			if mpo.TestImage == "" {
+				mpo.TestImage = props[internalconfig.TestImage]
+			}
+			stat, err := hh.installMeshIntegration(ctx, ee.OperationId, opReq.IsDeleteOperation, version, opReq.Namespace, opts.Forwarder, opts.SkipNSMInstall, integration, mpo, kubeConfigs)
+			if err != nil {
+				summary := fmt.Sprintf("Error while %s NSM with %s", stat, integration.Name)
+				hh.streamErr(summary, ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("NSM with %s %s successfully", integration.Name, stat)
+			ee.Details = fmt.Sprintf("The NSM integration with %s is now %s.", integration.Name, stat)
+			hh.streamResult(ctx, ee)
 		}(mesh, e)
 	case common.BookInfoOperation, common.HTTPBinOperation, common.ImageHubOperation, common.EmojiVotoOperation:
 		go func(hh *Mesh, ee *meshes.EventsResponse) {
 			appName := operations[opReq.OperationName].AdditionalProperties[common.ServiceName]
-			stat, err := hh.installSampleApp(opReq.Namespace, opReq.IsDeleteOperation, operations[opReq.OperationName].Templates, kubeConfigs)
+			ctx := templateCtx
+			stat, err := hh.installSampleApp(ctx, opReq.Namespace, opReq.IsDeleteOperation, operations[opReq.OperationName].Templates, kubeConfigs)
 			if err != nil {
 				summary := fmt.Sprintf("Error while %s %s application", stat, appName)
 				e.Details = err.Error()
@@ -86,11 +249,12 @@ func (mesh *Mesh) ApplyOperation(ctx context.Context, opReq adapter.OperationReq
 			}
 			ee.Summary = fmt.Sprintf("%s application %s successfully", appName, stat)
 			ee.Details = fmt.Sprintf("The %s application is now %s.", appName, stat)
-			hh.StreamInfo(e)
+			hh.streamResult(ctx, e)
 		}(mesh, e)
 	case common.CustomOperation:
 		go func(hh *Mesh, ee *meshes.EventsResponse) {
-			stat, err := hh.applyCustomOperation(opReq.Namespace, opReq.CustomBody, opReq.IsDeleteOperation, kubeConfigs)
+			ctx := templateCtx
+			stat, err := hh.applyCustomOperation(ctx, opReq.Namespace, customBody, opts.Kustomize, opReq.IsDeleteOperation, kubeConfigs)
 			if err != nil {
 				summary := fmt.Sprintf("Error while %s custom operation", stat)
 				e.Details = err.Error()
@@ -99,15 +263,15 @@ func (mesh *Mesh) ApplyOperation(ctx context.Context, opReq adapter.OperationReq
 			}
 			ee.Summary = fmt.Sprintf("Manifest %s successfully", status.Deployed)
 			ee.Details = ""
-			hh.StreamInfo(e)
+			hh.streamResult(ctx, e)
 		}(mesh, e)
 	case internalconfig.NSMICMPResponderSampleApp, internalconfig.NSMVPPICMPResponderSampleApp, internalconfig.NSMVPMSampleApp:
 		go func(hh *Mesh, ee *meshes.EventsResponse) {
 			version := string(operations[internalconfig.NSMMeshOperation].Versions[0])
-			// chart := operations[opReq.OperationName].AdditionalProperties[internalconfig.HelmChart]
+			chart := operations[opReq.OperationName].AdditionalProperties[internalconfig.HelmChart]
 			appName := operations[opReq.OperationName].AdditionalProperties[common.ServiceName]
 
-			stat, err := hh.installNSMSampleApp(opReq.IsDeleteOperation, version, opReq.Namespace, kubeConfigs)
+			stat, err := hh.installNSMSampleApp(ctx, opReq.IsDeleteOperation, chart, version, opReq.Namespace, kubeConfigs)
 			if err != nil {
 				summary := fmt.Sprintf("Error while %s %s application", stat, appName)
 				e.Details = err.Error()
@@ -116,11 +280,204 @@ func (mesh *Mesh) ApplyOperation(ctx context.Context, opReq adapter.OperationReq
 			}
 			ee.Summary = fmt.Sprintf("%s application %s successfully", appName, stat)
 			ee.Details = fmt.Sprintf("The %s application is now %s.", appName, stat)
-			hh.StreamInfo(e)
+			hh.streamResult(ctx, e)
+		}(mesh, e)
+	case internalconfig.NSMPreflightOperation:
+		go func(hh *Mesh, ee *meshes.EventsResponse) {
+			version := string(operations[internalconfig.NSMMeshOperation].Versions[0])
+			if opts.Forwarder == "" {
+				opts.Forwarder = operations[internalconfig.NSMMeshOperation].AdditionalProperties[internalconfig.Forwarder]
+			}
+			err := hh.preflight(ee.OperationId, version, opReq.Namespace, opts.Forwarder, kubeConfigs)
+			if err != nil {
+				summary := fmt.Sprintf("Error while %s pre-flight checks", status.Running)
+				hh.streamErr(summary, ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("Pre-flight checks %s successfully", status.Completed)
+			ee.Details = "The clusters satisfy the requirements for installing NSM."
+			hh.streamResult(ctx, ee)
+		}(mesh, e)
+	case internalconfig.NSMDiffOperation:
+		go func(hh *Mesh, ee *meshes.EventsResponse) {
+			drift, err := hh.diffNSM(ctx, opReq.Namespace, kubeConfigs)
+			if err != nil {
+				summary := fmt.Sprintf("Error while %s NSM diff", status.Running)
+				hh.streamErr(summary, ee, err)
+				return
+			}
+			hh.streamDrift(ee.OperationId, drift)
+			ee.Summary = fmt.Sprintf("NSM diff %s successfully", status.Completed)
+			ee.Details = fmt.Sprintf("Compared the NSM installation on %d clusters.", len(kubeConfigs))
+			hh.streamResult(ctx, ee)
+		}(mesh, e)
+	case internalconfig.NSMHistoryOperation:
+		go func(hh *Mesh, ee *meshes.EventsResponse) {
+			if hh.journal == nil {
+				hh.streamErr("Error while reading operation history", ee, ErrJournal(fmt.Errorf("journal %s is not available", internalconfig.JournalPath())))
+				return
+			}
+			history, err := hh.journal.history(opts.Limit)
+			if err != nil {
+				hh.streamErr("Error while reading operation history", ee, err)
+				return
+			}
+			details, err := json.Marshal(history)
+			if err != nil {
+				hh.streamErr("Error while encoding operation history", ee, ErrJournal(err))
+				return
+			}
+			ee.Summary = fmt.Sprintf("Operation history: %d installs, %d operations", len(history.Installs), len(history.Operations))
+			ee.Details = string(details)
+			hh.streamResult(ctx, ee)
+		}(mesh, e)
+	case internalconfig.NSMJaegerAddon, internalconfig.NSMPrometheusAddon, internalconfig.NSMGrafanaAddon:
+		go func(hh *Mesh, ee *meshes.EventsResponse) {
+			a, err := getAddon(operations[opReq.OperationName].AdditionalProperties[common.ServiceName])
+			if err != nil {
+				hh.streamErr("Error while resolving add-on", ee, err)
+				return
+			}
+			if opts.MetricsPort == "" {
+				opts.MetricsPort = operations[internalconfig.NSMMetricsOperation].AdditionalProperties[internalconfig.MetricsPort]
+			}
+			stat, err := hh.installAddon(ctx, opReq.IsDeleteOperation, opReq.Namespace, opts.MetricsPort, a, kubeConfigs)
+			if err != nil {
+				summary := fmt.Sprintf("Error while %s %s add-on", stat, a.Name)
+				hh.streamErr(summary, ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("%s add-on %s successfully", a.Name, stat)
+			ee.Details = fmt.Sprintf("The %s add-on is now %s in namespace %s.", a.Name, stat, opReq.Namespace)
+			hh.streamResult(ctx, ee)
+		}(mesh, e)
+	case internalconfig.NSMInspectOperation:
+		go func(hh *Mesh, ee *meshes.EventsResponse) {
+			graph, err := hh.inspectTopology(ctx, opReq.Namespace, kubeConfigs)
+			if err != nil {
+				summary := fmt.Sprintf("Error while %s NSM inspection", status.Running)
+				hh.streamErr(summary, ee, err)
+				return
+			}
+			details, err := json.Marshal(graph)
+			if err != nil {
+				hh.streamErr("Error while encoding connection topology", ee, ErrInspectTopology(err))
+				return
+			}
+			ee.Summary = fmt.Sprintf("Connection topology: %d nodes, %d edges", len(graph.Nodes), len(graph.Edges))
+			ee.Details = string(details)
+			hh.streamResult(ctx, ee)
+		}(mesh, e)
+	case internalconfig.NSMBenchmarkOperation:
+		go func(hh *Mesh, ee *meshes.EventsResponse) {
+			bo := opts.Benchmark
+			if bo.Image == "" {
+				bo.Image = operations[opReq.OperationName].AdditionalProperties[internalconfig.TestImage]
+			}
+			results, err := hh.benchmarkDatapaths(ctx, ee.OperationId, opReq.Namespace, bo, kubeConfigs)
+			if err != nil {
+				summary := fmt.Sprintf("Error while %s datapath benchmark", status.Running)
+				hh.streamErr(summary, ee, err)
+				return
+			}
+			if dryRunFrom(ctx) != nil {
+				hh.streamResult(ctx, ee)
+				return
+			}
+			details, err := marshalBenchmarkResults(results)
+			if err != nil {
+				hh.streamErr("Error while encoding benchmark results", ee, ErrBenchmark(err))
+				return
+			}
+			ee.Summary = fmt.Sprintf("Datapath benchmark %s: %s", status.Completed, benchmarkSummary(results))
+			ee.Details = string(details)
+			hh.streamResult(ctx, ee)
+		}(mesh, e)
+	case internalconfig.NSMHealOperation:
+		go func(hh *Mesh, ee *meshes.EventsResponse) {
+			ho := opts.Heal
+			if ho.Image == "" {
+				ho.Image = operations[opReq.OperationName].AdditionalProperties[internalconfig.TestImage]
+			}
+			report, err := hh.verifyHealing(ctx, ee.OperationId, opReq.Namespace, ho, kubeConfigs)
+			if err != nil {
+				summary := fmt.Sprintf("Error while %s heal verification", status.Running)
+				hh.streamErr(summary, ee, err)
+				return
+			}
+			if dryRunFrom(ctx) != nil {
+				hh.streamResult(ctx, ee)
+				return
+			}
+			details, err := json.Marshal(report)
+			if err != nil {
+				hh.streamErr("Error while encoding heal report", ee, ErrHeal(err))
+				return
+			}
+			if !report.Recovered {
+				hh.streamErr(fmt.Sprintf("Connection on %s did not heal from all faults", report.Cluster), ee, ErrHeal(fmt.Errorf("%s", details)))
+				return
+			}
+			ee.Summary = fmt.Sprintf("Connection on %s healed from %d faults", report.Cluster, len(report.Results))
+			ee.Details = string(details)
+			hh.streamResult(ctx, ee)
+		}(mesh, e)
+	case internalconfig.NSMConnectivityOperation:
+		go func(hh *Mesh, ee *meshes.EventsResponse) {
+			co := opts.Connectivity
+			if co.PodNamespace == "" {
+				co.PodNamespace = opReq.Namespace
+			}
+			if co.Image == "" {
+				co.Image = operations[opReq.OperationName].AdditionalProperties[internalconfig.TestImage]
+			}
+			report, err := hh.testConnectivity(ctx, ee.OperationId, co, kubeConfigs)
+			if err != nil {
+				summary := fmt.Sprintf("Error while %s connectivity test", status.Running)
+				hh.streamErr(summary, ee, err)
+				return
+			}
+			details, err := json.Marshal(report)
+			if err != nil {
+				hh.streamErr("Error while encoding connectivity report", ee, ErrConnectivity(err))
+				return
+			}
+			if !report.Passed {
+				hh.streamErr(fmt.Sprintf("Connectivity test from %s to %s failed", report.Pod, report.Target), ee, ErrConnectivity(fmt.Errorf("%s", details)))
+				return
+			}
+			ee.Summary = fmt.Sprintf("Connectivity test from %s to %s passed", report.Pod, report.Target)
+			ee.Details = string(details)
+			hh.streamResult(ctx, ee)
+		}(mesh, e)
+	case internalconfig.NSMMetricsOperation:
+		go func(hh *Mesh, ee *meshes.EventsResponse) {
+			props := operations[opReq.OperationName].AdditionalProperties
+			if opts.MetricsPort == "" {
+				opts.MetricsPort = props[internalconfig.MetricsPort]
+			}
+			if len(opts.Series) == 0 {
+				opts.Series = strings.Split(props[internalconfig.MetricsSeries], ",")
+			}
+			collected, err := hh.collectDataplaneMetrics(ctx, opReq.Namespace, opts.MetricsPort, opts.Series, kubeConfigs)
+			hh.streamDataplaneMetrics(ee.OperationId, collected)
+			if err != nil {
+				summary := fmt.Sprintf("Error while %s NSM metrics collection", status.Running)
+				hh.streamErr(summary, ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("NSM metrics collection %s successfully", status.Completed)
+			ee.Details = fmt.Sprintf("Collected the NSM metrics of %d clusters.", len(collected))
+			hh.streamResult(ctx, ee)
 		}(mesh, e)
 	case common.SmiConformanceOperation:
 		go func(hh *Mesh, ee *meshes.EventsResponse) {
 			name := operations[opReq.OperationName].Description
+			if report := dryRunFrom(ctx); report != nil {
+				report.record(plannedChange{Action: plannedRun, Object: fmt.Sprintf("%s test", name)})
+				hh.streamResult(ctx, ee)
+				return
+			}
 			_, err := hh.RunSMITest(adapter.SMITestOptions{
 				Ctx:         context.TODO(),
 				OperationID: ee.OperationId,
@@ -138,7 +495,7 @@ func (mesh *Mesh) ApplyOperation(ctx context.Context, opReq adapter.OperationReq
 			}
 			ee.Summary = fmt.Sprintf("%s test %s successfully", name, status.Completed)
 			ee.Details = ""
-			hh.StreamInfo(e)
+			hh.streamResult(ctx, e)
 		}(mesh, e)
 	default:
 		summary := "invalid request"
@@ -148,11 +505,41 @@ func (mesh *Mesh) ApplyOperation(ctx context.Context, opReq adapter.OperationReq
 	return nil
 }
 
+// clusterName returns the name used to identify the cluster of the i-th
+// kubeconfig of a request in events and reports
+func clusterName(i int) string {
+	return fmt.Sprintf("cluster-%d", i)
+}
+
+// streamResult streams the result of a successful operation. For dry-run
+// operations the changes the operation would have made are streamed instead
+func (mesh *Mesh) streamResult(ctx context.Context, e *meshes.EventsResponse) {
+	mesh.journalFinish(e.OperationId, nil)
+	report := dryRunFrom(ctx)
+	if report == nil {
+		mesh.operationFinished(e.OperationId, nil)
+		mesh.StreamInfo(e)
+		return
+	}
+
+	details, err := report.json()
+	if err != nil {
+		mesh.streamErr("Error while encoding dry-run report", e, err)
+		return
+	}
+	mesh.operationFinished(e.OperationId, nil)
+	e.Summary = fmt.Sprintf("Dry run %s, %d changes planned", status.Completed, len(report.Changes))
+	e.Details = details
+	mesh.StreamInfo(e)
+}
+
 func (mesh *Mesh) streamErr(summary string, e *meshes.EventsResponse, err error) {
 	e.Summary = summary
 	e.Details = err.Error()
 	e.ErrorCode = errors.GetCode(err)
 	e.ProbableCause = errors.GetCause(err)
 	e.SuggestedRemediation = errors.GetRemedy(err)
+	mesh.journalFinish(e.OperationId, err)
+	mesh.operationFinished(e.OperationId, err)
 	mesh.StreamErr(e, err)
 }
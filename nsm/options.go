@@ -0,0 +1,144 @@
+package nsm
+
+import (
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/common"
+	"sigs.k8s.io/yaml"
+)
+
+// operationOptionsKind is the kind of the document carrying the options
+// of a custom operation ahead of its manifest
+const operationOptionsKind = "OperationOptions"
+
+// operationOptions are the per-request options of the operations. As the
+// operation request has no place for arbitrary properties, they are passed
+// as YAML (or JSON) in the custom body of non-custom operations
+type operationOptions struct {
+	// DryRun reports the changes the operation would make instead
+	// of making them
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Forwarder is the forwarder profile used by the NSM install
+	Forwarder string `json:"forwarder,omitempty"`
+
+	// FloatingCluster is the index of the kubeconfig of the cluster
+	// which hosts the floating interdomain registry
+	FloatingCluster int `json:"floatingCluster,omitempty"`
+
+	// CIDR is the address range of the vL3 network
+	CIDR string `json:"cidr,omitempty"`
+
+	// Replicas is the number of vL3 NSEs on each cluster
+	Replicas int `json:"replicas,omitempty"`
+
+	// MeshProxy are the options of the proxy NSE of the service mesh
+	// integrations
+	MeshProxy meshProxyOptions `json:"meshProxy,omitempty"`
+
+	// SkipNSMInstall integrates with the service mesh on top of an
+	// existing NSM install instead of installing NSM alongside it
+	SkipNSMInstall bool `json:"skipNSMInstall,omitempty"`
+
+	// Limit is the number of operations returned by the history
+	Limit int `json:"limit,omitempty"`
+
+	// Strict stops applying a manifest at the first object which fails
+	// instead of ignoring the failure. It defaults to true for custom
+	// operations and to false for the other operations
+	Strict *bool `json:"strict,omitempty"`
+
+	// Rollback deletes the objects created by a strictly applied manifest
+	// when one of its objects fails
+	Rollback bool `json:"rollback,omitempty"`
+
+	// ForceConflicts takes over the fields of the applied objects which
+	// are managed by other field managers instead of failing the apply
+	ForceConflicts bool `json:"forceConflicts,omitempty"`
+
+	// Kustomize is the kustomization custom operations build and apply
+	// in place of their manifest
+	Kustomize *kustomizeOptions `json:"kustomize,omitempty"`
+
+	// Template renders the manifests of custom operations and sample apps
+	// as Go templates of the manifest variables before applying them
+	Template bool `json:"template,omitempty"`
+
+	// Registry is the registry of the NSM images available to the
+	// manifest templates of custom operations and sample apps
+	Registry string `json:"registry,omitempty"`
+
+	// Params are the parameters available to the manifest templates of
+	// custom operations and sample apps
+	Params map[string]string `json:"params,omitempty"`
+
+	// MetricsPort is the port the NSM components serve their metrics on
+	// when their pods do not declare one
+	MetricsPort string `json:"metricsPort,omitempty"`
+
+	// Series are the glob patterns of the names of the metric series
+	// collected from the NSM components
+	Series []string `json:"series,omitempty"`
+
+	// Connectivity are the options of the connectivity test
+	Connectivity connectivityOptions `json:"connectivity,omitempty"`
+
+	// Benchmark are the options of the datapath benchmark
+	Benchmark benchmarkOptions `json:"benchmark,omitempty"`
+
+	// Heal are the options of the heal verification
+	Heal healOptions `json:"heal,omitempty"`
+}
+
+// strict returns whether the manifests of the operation are applied strictly
+func (o *operationOptions) strict(operation string) bool {
+	if o.Strict != nil {
+		return *o.Strict
+	}
+	return operation == common.CustomOperation
+}
+
+// parseOperationOptions parses the custom body of a request into the
+// operation options, an empty body yields the zero value options
+func parseOperationOptions(body string) (*operationOptions, error) {
+	opts := &operationOptions{}
+	if body == "" {
+		return opts, nil
+	}
+
+	if err := yaml.Unmarshal([]byte(body), opts); err != nil {
+		return nil, ErrParseOperationOptions(err)
+	}
+	return opts, nil
+}
+
+// parseRequestOptions returns the options of the request along with the
+// manifest of custom operations. As the custom body of custom operations is
+// the manifest to apply, their options are passed as a leading document of
+// kind OperationOptions which is stripped from the returned manifest
+func parseRequestOptions(opReq adapter.OperationRequest) (*operationOptions, string, error) {
+	if opReq.OperationName != common.CustomOperation {
+		opts, err := parseOperationOptions(opReq.CustomBody)
+		return opts, "", err
+	}
+
+	body := strings.TrimPrefix(strings.TrimLeft(opReq.CustomBody, "\n"), "---\n")
+	docs := strings.SplitN(body, "\n---\n", 2)
+
+	var head struct {
+		Kind string `json:"kind"`
+	}
+	if err := yaml.Unmarshal([]byte(docs[0]), &head); err != nil || head.Kind != operationOptionsKind {
+		return &operationOptions{}, opReq.CustomBody, nil
+	}
+
+	opts, err := parseOperationOptions(docs[0])
+	if err != nil {
+		return nil, "", err
+	}
+	if len(docs) == 1 {
+		return opts, "", nil
+	}
+	return opts, docs[1], nil
+}
@@ -0,0 +1,334 @@
+package nsm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/meshes"
+	internalconfig "github.com/layer5io/meshery-nsm/internal/config"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+const (
+	// preflightPassed marks a check that succeeded
+	preflightPassed = "passed"
+	// preflightWarning marks a check that failed but does not block the install
+	preflightWarning = "warning"
+	// preflightFailed marks a check that failed and blocks the install
+	preflightFailed = "failed"
+)
+
+// preflightResult is the outcome of a single pre-flight check on a single cluster
+type preflightResult struct {
+	Cluster string `json:"cluster"`
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// preflightReport is the collection of results of all the pre-flight
+// checks that were run against the requested clusters
+type preflightReport struct {
+	Version   string            `json:"version"`
+	Namespace string            `json:"namespace"`
+	Forwarder string            `json:"forwarder"`
+	Results   []preflightResult `json:"results"`
+}
+
+// hasFailures returns true if any of the checks in the report is a hard failure
+func (r *preflightReport) hasFailures() bool {
+	for _, res := range r.Results {
+		if res.Status == preflightFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// failures returns the messages of all of the hard failures in the report
+func (r *preflightReport) failures() []string {
+	var msgs []string
+	for _, res := range r.Results {
+		if res.Status == preflightFailed {
+			msgs = append(msgs, fmt.Sprintf("%s: %s: %s", res.Cluster, res.Check, res.Message))
+		}
+	}
+	return msgs
+}
+
+// kubernetesVersionRange is the range of kubernetes server versions
+// which are known to work with a range of NSM versions
+type kubernetesVersionRange struct {
+	// NSM is the minimum NSM version this range applies to
+	NSM string
+	// Min is the minimum supported kubernetes version (inclusive)
+	Min string
+	// Max is the first unsupported kubernetes version, empty if unbounded
+	Max string
+}
+
+// kubernetesCompatibility is sorted by NSM version in descending order,
+// the first entry whose NSM version is less than or equal to the requested
+// one is used
+var kubernetesCompatibility = []kubernetesVersionRange{
+	{NSM: "1.0.0", Min: "1.19.0"},
+	// The 0.x helm charts ship apiextensions.k8s.io/v1beta1 CRDs which
+	// were removed in kubernetes 1.22
+	{NSM: "0.0.0", Min: "1.13.0", Max: "1.22.0"},
+}
+
+// requiredPermissions are the permissions the adapter's kubeconfig needs
+// in order to install NSM
+var requiredPermissions = []authorizationv1.ResourceAttributes{
+	{Verb: "create", Resource: "namespaces"},
+	{Verb: "create", Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"},
+	{Verb: "create", Group: "rbac.authorization.k8s.io", Resource: "clusterroles"},
+	{Verb: "create", Group: "rbac.authorization.k8s.io", Resource: "clusterrolebindings"},
+	{Verb: "create", Group: "admissionregistration.k8s.io", Resource: "mutatingwebhookconfigurations"},
+	{Verb: "create", Group: "apps", Resource: "daemonsets"},
+	{Verb: "create", Group: "apps", Resource: "deployments"},
+}
+
+// knownCNIs are the name prefixes of the kube-system daemonsets of the CNI
+// plugins which are known to work with NSM
+var knownCNIs = []string{
+	"calico",
+	"cilium",
+	"kube-flannel",
+	"flannel",
+	"weave",
+	"kindnet",
+	"kube-router",
+	"antrea",
+	"aws-node",
+	"canal",
+}
+
+// nsmComponentNames are the workload names used to detect an existing NSM installation
+var nsmComponentNames = []string{"nsmgr", "nsm-admission-webhook", "nsmd"}
+
+// runPreflightChecks runs all of the pre-flight checks against each of the kubeconfigs
+// concurrently and returns the collected report
+func (mesh *Mesh) runPreflightChecks(version, namespace, forwarder string, kubeconfigs []string) (*preflightReport, error) {
+	forwarder, profile, err := getForwarderProfile(forwarder)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &preflightReport{
+		Version:   version,
+		Namespace: namespace,
+		Forwarder: forwarder,
+	}
+
+	var wg sync.WaitGroup
+	var resMx sync.Mutex
+	for i, config := range kubeconfigs {
+		wg.Add(1)
+		go func(i int, config string) {
+			defer wg.Done()
+			results := mesh.preflightCluster(version, namespace, profile, clusterName(i), config)
+			resMx.Lock()
+			report.Results = append(report.Results, results...)
+			resMx.Unlock()
+		}(i, config)
+	}
+	wg.Wait()
+
+	return report, nil
+}
+
+// preflightCluster runs all of the pre-flight checks against a single cluster
+func (mesh *Mesh) preflightCluster(nsmVersion, namespace string, profile forwarderProfile, cluster, config string) []preflightResult {
+	kClient, err := mesherykube.New([]byte(config))
+	if err != nil {
+		return []preflightResult{{
+			Cluster: cluster,
+			Check:   "connectivity",
+			Status:  preflightFailed,
+			Message: err.Error(),
+		}}
+	}
+
+	checks := []struct {
+		name string
+		run  func(*mesherykube.Client) (string, string)
+	}{
+		{"kubernetes-version", func(c *mesherykube.Client) (string, string) { return checkKubernetesVersion(c, nsmVersion) }},
+		{"rbac", checkPermissions},
+		{"conflicting-install", func(c *mesherykube.Client) (string, string) { return checkConflictingInstall(c, namespace) }},
+		{"node-requirements", profile.CheckNodes},
+		{"cni", checkCNI},
+	}
+
+	results := make([]preflightResult, 0, len(checks))
+	for _, check := range checks {
+		st, msg := check.run(kClient)
+		results = append(results, preflightResult{
+			Cluster: cluster,
+			Check:   check.name,
+			Status:  st,
+			Message: msg,
+		})
+	}
+	return results
+}
+
+// checkKubernetesVersion verifies that the kubernetes server version is compatible
+// with the requested NSM version
+func checkKubernetesVersion(kClient *mesherykube.Client, nsmVersion string) (string, string) {
+	info, err := kClient.KubeClient.Discovery().ServerVersion()
+	if err != nil {
+		return preflightFailed, fmt.Sprintf("unable to fetch server version: %s", err)
+	}
+	serverVersion, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return preflightFailed, fmt.Sprintf("unable to parse server version %s: %s", info.GitVersion, err)
+	}
+
+	requested, err := version.ParseGeneric(nsmVersion)
+	if err != nil {
+		return preflightWarning, fmt.Sprintf("unable to parse NSM version %s, skipping compatibility check", nsmVersion)
+	}
+
+	for _, r := range kubernetesCompatibility {
+		if requested.LessThan(version.MustParseGeneric(r.NSM)) {
+			continue
+		}
+		if serverVersion.LessThan(version.MustParseGeneric(r.Min)) {
+			return preflightFailed, fmt.Sprintf("kubernetes %s is older than the minimum supported version %s for NSM %s", info.GitVersion, r.Min, nsmVersion)
+		}
+		if r.Max != "" && !serverVersion.LessThan(version.MustParseGeneric(r.Max)) {
+			return preflightFailed, fmt.Sprintf("kubernetes %s is not supported by NSM %s, use a version older than %s", info.GitVersion, nsmVersion, r.Max)
+		}
+		break
+	}
+
+	return preflightPassed, fmt.Sprintf("kubernetes %s is compatible with NSM %s", info.GitVersion, nsmVersion)
+}
+
+// checkPermissions verifies that the kubeconfig is allowed to create all of the
+// resources required by the NSM install
+func checkPermissions(kClient *mesherykube.Client) (string, string) {
+	var denied []string
+	for _, perm := range requiredPermissions {
+		attrs := perm
+		review, err := kClient.KubeClient.AuthorizationV1().SelfSubjectAccessReviews().Create(context.TODO(), &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &attrs,
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return preflightFailed, fmt.Sprintf("unable to review access: %s", err)
+		}
+		if !review.Status.Allowed {
+			denied = append(denied, fmt.Sprintf("%s %s", perm.Verb, perm.Resource))
+		}
+	}
+
+	if len(denied) != 0 {
+		return preflightFailed, fmt.Sprintf("missing permissions: %s", strings.Join(denied, ", "))
+	}
+	return preflightPassed, "all required permissions are granted"
+}
+
+// checkConflictingInstall verifies that NSM is not already installed in any
+// namespace other than the requested one
+func checkConflictingInstall(kClient *mesherykube.Client, namespace string) (string, string) {
+	var found []string
+
+	deployments, err := kClient.KubeClient.AppsV1().Deployments(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return preflightFailed, fmt.Sprintf("unable to list deployments: %s", err)
+	}
+	for _, d := range deployments.Items {
+		if d.Namespace != namespace && isNSMComponent(d.Name) {
+			found = append(found, fmt.Sprintf("%s/%s", d.Namespace, d.Name))
+		}
+	}
+
+	daemonsets, err := kClient.KubeClient.AppsV1().DaemonSets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return preflightFailed, fmt.Sprintf("unable to list daemonsets: %s", err)
+	}
+	for _, d := range daemonsets.Items {
+		if d.Namespace != namespace && isNSMComponent(d.Name) {
+			found = append(found, fmt.Sprintf("%s/%s", d.Namespace, d.Name))
+		}
+	}
+
+	if len(found) != 0 {
+		return preflightFailed, fmt.Sprintf("NSM is already installed: %s", strings.Join(found, ", "))
+	}
+	return preflightPassed, "no conflicting NSM installation found"
+}
+
+// checkCNI detects the CNI plugin used by the cluster and verifies that it is
+// known to work with NSM
+func checkCNI(kClient *mesherykube.Client) (string, string) {
+	daemonsets, err := kClient.KubeClient.AppsV1().DaemonSets(metav1.NamespaceSystem).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return preflightWarning, fmt.Sprintf("unable to list %s daemonsets: %s", metav1.NamespaceSystem, err)
+	}
+
+	for _, d := range daemonsets.Items {
+		for _, cni := range knownCNIs {
+			if strings.HasPrefix(d.Name, cni) {
+				return preflightPassed, fmt.Sprintf("CNI %s is compatible with NSM", cni)
+			}
+		}
+	}
+
+	return preflightWarning, "unable to detect a CNI plugin known to work with NSM"
+}
+
+// isNSMComponent returns true if the workload name belongs to an NSM component
+func isNSMComponent(name string) bool {
+	for _, c := range nsmComponentNames {
+		if strings.HasPrefix(name, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamPreflightReport streams the pre-flight report as an event
+func (mesh *Mesh) streamPreflightReport(opID string, report *preflightReport) {
+	e := &meshes.EventsResponse{
+		OperationId:   opID,
+		Component:     internalconfig.ServerConfig["type"],
+		ComponentName: internalconfig.ServerConfig["name"],
+	}
+
+	details, err := json.Marshal(report)
+	if err != nil {
+		mesh.streamErr("Error while encoding pre-flight report", e, ErrPreflight(err))
+		return
+	}
+	e.Details = string(details)
+	e.Summary = fmt.Sprintf("Pre-flight checks %s", preflightPassed)
+	if report.hasFailures() {
+		e.Summary = fmt.Sprintf("Pre-flight checks %s", preflightFailed)
+	}
+	mesh.StreamInfo(e)
+}
+
+// preflight runs the pre-flight checks, streams the report and returns
+// an error if any of the checks is a hard failure
+func (mesh *Mesh) preflight(opID, version, namespace, forwarder string, kubeconfigs []string) error {
+	report, err := mesh.runPreflightChecks(version, namespace, forwarder, kubeconfigs)
+	if err != nil {
+		return ErrPreflight(err)
+	}
+	mesh.streamPreflightReport(opID, report)
+	if report.hasFailures() {
+		return ErrPreflightFailed(report.failures())
+	}
+	return nil
+}
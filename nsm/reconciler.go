@@ -0,0 +1,363 @@
+package nsm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/layer5io/meshery-adapter-library/meshes"
+	internalconfig "github.com/layer5io/meshery-nsm/internal/config"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// ReconcileReport only reports the drift of the clusters
+	ReconcileReport = "report"
+	// ReconcileCorrect reports and corrects the drift of the clusters
+	ReconcileCorrect = "correct"
+)
+
+// ReconcileOptions configures the background drift reconciler
+type ReconcileOptions struct {
+	// Interval is the time between two reconciliations
+	Interval time.Duration
+	// Mode is either ReconcileReport or ReconcileCorrect
+	Mode string
+	// Ignore are the rules of the drift which is neither reported nor
+	// corrected, in the form <kind>/<namespace>/<name>[:<field>], or
+	// <kind>/<name>[:<field>] for cluster scoped objects. The object and
+	// the field are glob patterns, e.g. "DaemonSet/nsm-system/forwarder-*:spec.template"
+	Ignore []string
+}
+
+// ignoreRule is a parsed rule of ReconcileOptions.Ignore
+type ignoreRule struct {
+	Object string
+	Field  string
+}
+
+// parseIgnoreRules parses and validates the ignore rules
+func parseIgnoreRules(rules []string) (ignoreRules, error) {
+	parsed := make(ignoreRules, 0, len(rules))
+	for _, r := range rules {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		rule := ignoreRule{Object: r}
+		if i := strings.Index(r, ":"); i != -1 {
+			rule.Object, rule.Field = r[:i], r[i+1:]
+		}
+		if _, err := path.Match(rule.Object, ""); err != nil {
+			return nil, ErrInvalidIgnoreRule(r, err)
+		}
+		if _, err := path.Match(rule.Field, ""); err != nil {
+			return nil, ErrInvalidIgnoreRule(r, err)
+		}
+		parsed = append(parsed, rule)
+	}
+	return parsed, nil
+}
+
+// ignoresObject returns true if the whole object is ignored by the rule
+func (r ignoreRule) ignoresObject(ref string) bool {
+	ok, _ := path.Match(r.Object, ref)
+	return ok && r.Field == ""
+}
+
+// ignoresField returns true if the field of the object, or any of its
+// parent fields, is ignored by the rule
+func (r ignoreRule) ignoresField(ref, field string) bool {
+	if ok, _ := path.Match(r.Object, ref); !ok || r.Field == "" {
+		return ok
+	}
+	for p := field; p != ""; {
+		if ok, _ := path.Match(r.Field, p); ok {
+			return true
+		}
+		i := strings.LastIndex(p, ".")
+		if i == -1 {
+			break
+		}
+		p = p[:i]
+	}
+	return false
+}
+
+// ignoreRules is the set of ignore rules of the reconciler
+type ignoreRules []ignoreRule
+
+func (rules ignoreRules) ignoresObject(ref string) bool {
+	for _, r := range rules {
+		if r.ignoresObject(ref) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rules ignoreRules) ignoresField(ref, field string) bool {
+	for _, r := range rules {
+		if r.ignoresField(ref, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter drops the drift which is ignored by the rules
+func (rules ignoreRules) filter(entries []driftEntry) []driftEntry {
+	filtered := entries[:0]
+	for _, e := range entries {
+		if rules.ignoresObject(e.Object) {
+			continue
+		}
+		if e.State == driftChanged {
+			fields := make([]string, 0, len(e.Fields))
+			for _, f := range e.Fields {
+				if !rules.ignoresField(e.Object, f) {
+					fields = append(fields, f)
+				}
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			e.Fields = fields
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered
+}
+
+// reconcileTarget is a cluster and namespace NSM was installed to
+type reconcileTarget struct {
+	Cluster   string
+	Namespace string
+	Config    string
+}
+
+// reconcileTargets tracks the clusters and namespaces NSM was installed
+// to by the adapter, these are the targets of the reconciler
+type reconcileTargets struct {
+	mx      sync.Mutex
+	targets map[string]reconcileTarget
+}
+
+func newReconcileTargets() *reconcileTargets {
+	return &reconcileTargets{targets: make(map[string]reconcileTarget)}
+}
+
+// track adds the target after an install and removes it after an uninstall
+func (t *reconcileTargets) track(cluster, namespace, config string, isDel bool) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	key := namespace + "\n" + config
+	if isDel {
+		delete(t.targets, key)
+		return
+	}
+	t.targets[key] = reconcileTarget{
+		Cluster:   kubeContextName(config, cluster),
+		Namespace: namespace,
+		Config:    config,
+	}
+}
+
+// list returns the targets sorted by cluster and namespace
+func (t *reconcileTargets) list() []reconcileTarget {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	targets := make([]reconcileTarget, 0, len(t.targets))
+	for _, target := range t.targets {
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Cluster != targets[j].Cluster {
+			return targets[i].Cluster < targets[j].Cluster
+		}
+		return targets[i].Namespace < targets[j].Namespace
+	})
+	return targets
+}
+
+// kubeContextName returns the current context of the kubeconfig, which
+// identifies the cluster across operations, falling back to the name
+func kubeContextName(config, name string) string {
+	kubeconfig, err := clientcmd.Load([]byte(config))
+	if err != nil || kubeconfig.CurrentContext == "" {
+		return name
+	}
+	return kubeconfig.CurrentContext
+}
+
+// Reconcile periodically compares the live NSM objects on each of the
+// clusters NSM was installed to with the last applied desired state, and
+// reports or corrects the drift. It blocks until the context is done
+func (mesh *Mesh) Reconcile(ctx context.Context, opts ReconcileOptions) error {
+	if opts.Interval <= 0 {
+		return ErrReconcile(fmt.Errorf("invalid interval %s", opts.Interval))
+	}
+	if opts.Mode != ReconcileReport && opts.Mode != ReconcileCorrect {
+		return ErrReconcile(fmt.Errorf("invalid mode %q, use one of %s, %s", opts.Mode, ReconcileReport, ReconcileCorrect))
+	}
+	rules, err := parseIgnoreRules(opts.Ignore)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			for _, target := range mesh.targets.list() {
+				mesh.reconcile(ctx, target, rules, opts.Mode == ReconcileCorrect)
+			}
+		}
+	}
+}
+
+// reconcile reconciles a single target and streams the outcome, nothing
+// is streamed if the target did not drift
+func (mesh *Mesh) reconcile(ctx context.Context, target reconcileTarget, rules ignoreRules, correct bool) {
+	e := &meshes.EventsResponse{
+		OperationId:   uuid.New().String(),
+		Component:     internalconfig.ServerConfig["type"],
+		ComponentName: internalconfig.ServerConfig["name"],
+	}
+
+	entries, err := mesh.driftOfTarget(ctx, target, rules, correct)
+	if err != nil {
+		summary := fmt.Sprintf("Error while reconciling NSM on %s in %s", target.Cluster, target.Namespace)
+		mesh.streamErr(summary, e, err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	details, err := json.Marshal(entries)
+	if err != nil {
+		mesh.streamErr("Error while encoding NSM drift", e, ErrReconcile(err))
+		return
+	}
+	e.Summary = fmt.Sprintf("Drift detected on %s in %s: %d differences found", target.Cluster, target.Namespace, len(entries))
+	if correct {
+		e.Summary = fmt.Sprintf("Drift corrected on %s in %s: %d differences corrected", target.Cluster, target.Namespace, len(entries))
+	}
+	e.Details = string(details)
+	mesh.StreamInfo(e)
+}
+
+// driftOfTarget returns the drift of the target which is not ignored, and
+// corrects it if requested
+func (mesh *Mesh) driftOfTarget(ctx context.Context, target reconcileTarget, rules ignoreRules, correct bool) ([]driftEntry, error) {
+	kClient, err := mesherykube.New([]byte(target.Config))
+	if err != nil {
+		return nil, ErrReconcile(err)
+	}
+
+	objects, err := desiredReleaseObjects(kClient, internalconfig.NSMChart, target.Namespace, mesh.images)
+	if err != nil {
+		return nil, ErrReconcile(err)
+	}
+	entries, err := diffManifest(ctx, kClient, target.Cluster, objects, internalconfig.NSMChart, target.Namespace)
+	if err != nil {
+		return nil, ErrReconcile(err)
+	}
+	entries = rules.filter(entries)
+
+	if correct && len(entries) != 0 {
+		if err := correctDrift(ctx, kClient, objects, entries, rules, target.Namespace); err != nil {
+			return entries, ErrReconcile(err)
+		}
+	}
+	return entries, nil
+}
+
+// correctDrift creates the missing objects, reverts the fields of the
+// changed objects which are not ignored, and deletes the added objects
+func correctDrift(ctx context.Context, kClient *mesherykube.Client, objects []*unstructured.Unstructured, entries []driftEntry, rules ignoreRules, namespace string) error {
+	mapper := newRESTMapper(kClient)
+	desired := make(map[string]*unstructured.Unstructured, len(objects))
+	for _, obj := range objects {
+		desired[objectRef(obj)] = obj
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		var err error
+		switch entry.State {
+		case driftMissing:
+			obj := desired[entry.Object]
+			ri, rerr := resourceFor(kClient, mapper, obj, namespace)
+			if rerr != nil {
+				err = rerr
+				break
+			}
+			_, err = ri.Create(ctx, obj, metav1.CreateOptions{})
+		case driftChanged:
+			obj := desired[entry.Object]
+			ri, rerr := resourceFor(kClient, mapper, obj, namespace)
+			if rerr != nil {
+				err = rerr
+				break
+			}
+			live, gerr := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+			if gerr != nil {
+				err = gerr
+				break
+			}
+			revertFields("", entry.Object, live.Object, obj.Object, rules)
+			_, err = ri.Update(ctx, live, metav1.UpdateOptions{})
+		case driftAdded:
+			ri, rerr := resourceFor(kClient, mapper, entry.live, entry.live.GetNamespace())
+			if rerr != nil {
+				err = rerr
+				break
+			}
+			err = ri.Delete(ctx, entry.live.GetName(), metav1.DeleteOptions{})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", entry.Object, err))
+		}
+	}
+	return mergeErrors(errs)
+}
+
+// revertFields sets the fields of the live object to the desired values,
+// except for the fields which are ignored by the rules
+func revertFields(prefix, ref string, live, desired map[string]interface{}, rules ignoreRules) {
+	for k, dv := range desired {
+		p := k
+		if prefix != "" {
+			p = prefix + "." + k
+		}
+		if isIgnoredField(p) || rules.ignoresField(ref, p) {
+			continue
+		}
+
+		l, lok := live[k].(map[string]interface{})
+		d, dok := dv.(map[string]interface{})
+		if lok && dok {
+			revertFields(p, ref, l, d, rules)
+			continue
+		}
+		if !desiredEqual(live[k], dv) {
+			live[k] = dv
+		}
+	}
+}
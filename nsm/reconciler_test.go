@@ -0,0 +1,232 @@
+package nsm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseIgnoreRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		want    ignoreRules
+		wantErr bool
+	}{
+		{
+			name:  "object",
+			rules: []string{"DaemonSet/nsm-system/forwarder-*"},
+			want:  ignoreRules{{Object: "DaemonSet/nsm-system/forwarder-*"}},
+		},
+		{
+			name:  "object and field",
+			rules: []string{"DaemonSet/nsm-system/forwarder-*:spec.template"},
+			want:  ignoreRules{{Object: "DaemonSet/nsm-system/forwarder-*", Field: "spec.template"}},
+		},
+		{
+			name:  "blank rules are skipped",
+			rules: []string{" ", "", " ClusterRole/nsmgr "},
+			want:  ignoreRules{{Object: "ClusterRole/nsmgr"}},
+		},
+		{
+			name:    "invalid object pattern",
+			rules:   []string{"DaemonSet/[nsm"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid field pattern",
+			rules:   []string{"DaemonSet/nsm-system/nsmgr:spec.[template"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIgnoreRules(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIgnoreRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIgnoreRules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoresField(t *testing.T) {
+	rules, err := parseIgnoreRules([]string{
+		"DaemonSet/nsm-system/forwarder-*:spec.template",
+		"Deployment/nsm-system/registry-k8s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		object string
+		field  string
+		want   bool
+	}{
+		{
+			name:   "ignored field",
+			object: "DaemonSet/nsm-system/forwarder-vpp",
+			field:  "spec.template",
+			want:   true,
+		},
+		{
+			name:   "child of ignored field",
+			object: "DaemonSet/nsm-system/forwarder-vpp",
+			field:  "spec.template.spec.containers",
+			want:   true,
+		},
+		{
+			name:   "sibling of ignored field",
+			object: "DaemonSet/nsm-system/forwarder-vpp",
+			field:  "spec.selector",
+			want:   false,
+		},
+		{
+			name:   "field with ignored prefix",
+			object: "DaemonSet/nsm-system/forwarder-vpp",
+			field:  "spec.templates",
+			want:   false,
+		},
+		{
+			name:   "other object",
+			object: "DaemonSet/nsm-system/nsmgr",
+			field:  "spec.template",
+			want:   false,
+		},
+		{
+			name:   "field of ignored object",
+			object: "Deployment/nsm-system/registry-k8s",
+			field:  "spec.replicas",
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules.ignoresField(tt.object, tt.field); got != tt.want {
+				t.Errorf("ignoresField(%q, %q) = %v, want %v", tt.object, tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+// discoveryResponses are the discovery documents of an API server serving
+// the config maps and the deployments only
+var discoveryResponses = map[string]string{
+	"/api":          `{"kind": "APIVersions", "versions": ["v1"]}`,
+	"/api/v1":       `{"kind": "APIResourceList", "groupVersion": "v1", "resources": [{"name": "configmaps", "singularName": "configmap", "namespaced": true, "kind": "ConfigMap", "verbs": ["get"]}]}`,
+	"/apis":         `{"kind": "APIGroupList", "apiVersion": "v1", "groups": [{"name": "apps", "versions": [{"groupVersion": "apps/v1", "version": "v1"}], "preferredVersion": {"groupVersion": "apps/v1", "version": "v1"}}]}`,
+	"/apis/apps/v1": `{"kind": "APIResourceList", "groupVersion": "apps/v1", "resources": [{"name": "deployments", "singularName": "deployment", "namespaced": true, "kind": "Deployment", "verbs": ["get", "list", "update"]}]}`,
+}
+
+// fakeCluster serves the live deployment of the NSM release and returns the
+// client of the cluster
+func fakeCluster(t *testing.T, live *unstructured.Unstructured) *mesherykube.Client {
+	t.Helper()
+	live.SetLabels(map[string]string{"app": "nsmgr", "app.kubernetes.io/managed-by": "Helm"})
+	live.SetAnnotations(map[string]string{
+		helmReleaseAnnotation:          "nsm",
+		helmReleaseNamespaceAnnotation: "nsm-system",
+	})
+	item, err := live.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := map[string]string{
+		"/apis/apps/v1/namespaces/nsm-system/deployments/nsmgr": string(item),
+		"/apis/apps/v1/namespaces/nsm-system/deployments":       fmt.Sprintf(`{"apiVersion": "apps/v1", "kind": "DeploymentList", "metadata": {}, "items": [%s]}`, item),
+	}
+	for path, body := range discoveryResponses {
+		responses[path] = body
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		body, ok := responses[r.URL.Path]
+		if !ok || r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404}`))
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	kClient, err := mesherykube.New([]byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: test
+`, server.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kClient
+}
+
+func TestDiffManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas int
+		want     []driftEntry
+	}{
+		{
+			name:     "unchanged",
+			replicas: 1,
+		},
+		{
+			name:     "scaled",
+			replicas: 2,
+			want: []driftEntry{{
+				Cluster: "cluster-0",
+				State:   driftChanged,
+				Object:  "Deployment/nsm-system/nsmgr",
+				Fields:  []string{"spec.replicas"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := liveObject(t, fmt.Sprintf(liveDeployment, tt.replicas, "ghcr.io/networkservicemesh/cmd-nsmgr:v1.6.0"))
+			kClient := fakeCluster(t, live.DeepCopy())
+			desired := desiredObject(t, desiredDeployment)
+
+			got, err := diffManifest(context.Background(), kClient, "cluster-0", []*unstructured.Unstructured{desired}, "nsm", "nsm-system")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffManifest() = %+v, want %+v", got, tt.want)
+			}
+
+			// Reverting the drift only touches the changed fields
+			reverted := live.DeepCopy()
+			revertFields("", "Deployment/nsm-system/nsmgr", reverted.Object, desired.Object, nil)
+			if fields := diffDesiredFields(reverted.Object, desired.Object); len(fields) != 0 {
+				t.Errorf("fields %v still differ after reverting", fields)
+			}
+			if tt.want == nil && !reflect.DeepEqual(reverted, live) {
+				t.Errorf("reverting an unchanged object modified it")
+			}
+		})
+	}
+}
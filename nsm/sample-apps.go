@@ -1,30 +1,35 @@
 package nsm
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-adapter-library/status"
+	"github.com/layer5io/meshery-nsm/internal/metrics"
+	"github.com/layer5io/meshery-nsm/internal/tracing"
 	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"go.opentelemetry.io/otel/label"
 )
 
-func (mesh *Mesh) installNSMSampleApp(del bool, version, namespace string, kubeconfigs []string) (string, error) {
+func (mesh *Mesh) installNSMSampleApp(ctx context.Context, del bool, chart, version, namespace string, kubeconfigs []string) (string, error) {
 	st := status.Installing
 
 	if del {
 		st = status.Removing
 	}
 
-	if err := mesh.applyHelmChart(version, namespace, del, kubeconfigs); err != nil {
+	if err := mesh.applyHelmChart(ctx, chart, version, namespace, nil, del, kubeconfigs); err != nil {
 		return st, ErrSampleApp(err)
 	}
 
 	return status.Installed, nil
 }
 
-func (mesh *Mesh) installSampleApp(namespace string, del bool, templates []adapter.Template, kubeconfigs []string) (string, error) {
+func (mesh *Mesh) installSampleApp(ctx context.Context, namespace string, del bool, templates []adapter.Template, kubeconfigs []string) (string, error) {
 	st := status.Installing
 
 	if del {
@@ -32,7 +37,7 @@ func (mesh *Mesh) installSampleApp(namespace string, del bool, templates []adapt
 	}
 
 	for _, template := range templates {
-		err := mesh.applyManifest([]byte(template.String()), del, namespace, kubeconfigs)
+		err := mesh.applyManifest(ctx, []byte(template.String()), del, namespace, kubeconfigs)
 		if err != nil {
 			return st, ErrSampleApp(err)
 		}
@@ -41,34 +46,22 @@ func (mesh *Mesh) installSampleApp(namespace string, del bool, templates []adapt
 	return status.Installed, nil
 }
 
-func (mesh *Mesh) applyManifest(contents []byte, isDel bool, namespace string, kubeconfigs []string) error {
+func (mesh *Mesh) applyManifest(ctx context.Context, contents []byte, isDel bool, namespace string, kubeconfigs []string) error {
 	var wg sync.WaitGroup
 	var errs []error
 	var errMx sync.Mutex
-	for _, config := range kubeconfigs {
+	for i, config := range kubeconfigs {
 		wg.Add(1)
-		go func(config string) {
+		go func(cluster, config string) {
 			defer wg.Done()
-			kClient, err := mesherykube.New([]byte(config))
+			err := mesh.applyManifestToCluster(ctx, cluster, config, contents, isDel, namespace)
 			if err != nil {
 				errMx.Lock()
 				errs = append(errs, err)
 				errMx.Unlock()
 				return
 			}
-			err = kClient.ApplyManifest(contents, mesherykube.ApplyOptions{
-				Namespace:    namespace,
-				Update:       true,
-				Delete:       isDel,
-				IgnoreErrors: true,
-			})
-			if err != nil {
-				errMx.Lock()
-				errs = append(errs, err)
-				errMx.Unlock()
-				return
-			}
-		}(config)
+		}(clusterName(i), config)
 	}
 	wg.Wait()
 
@@ -78,6 +71,47 @@ func (mesh *Mesh) applyManifest(contents []byte, isDel bool, namespace string, k
 	return nil
 }
 
+// applyManifestToCluster applies or deletes the manifest on the cluster
+// of a single kubeconfig. For dry-run operations the changes it would make
+// are recorded instead
+func (mesh *Mesh) applyManifestToCluster(ctx context.Context, cluster, config string, contents []byte, isDel bool, namespace string) (err error) {
+	name := kubeContextName(config, cluster)
+	ctx, span := tracing.Start(ctx, "cluster",
+		label.String("cluster", name),
+		label.String("namespace", namespace),
+	)
+	defer func(started time.Time) {
+		metrics.ObserveApply(name, metrics.ApplyManifest, started, err)
+		tracing.End(ctx, span, err)
+	}(time.Now())
+
+	kClient, err := mesherykube.New([]byte(config))
+	if err != nil {
+		return err
+	}
+
+	if vars, ok := manifestVarsFrom(ctx); ok {
+		contents, err = renderManifest(contents, vars, name)
+		if err != nil {
+			return err
+		}
+	}
+	contents, err = mesh.images.rewriteManifest(ctx, contents)
+	if err != nil {
+		return err
+	}
+
+	if report := dryRunFrom(ctx); report != nil {
+		changes, err := dryRunManifest(ctx, kClient, cluster, contents, isDel, namespace)
+		if err != nil {
+			return err
+		}
+		report.record(changes...)
+		return nil
+	}
+	return mesh.applyObjects(ctx, kClient, cluster, contents, isDel, namespace, manifestApplyFrom(ctx))
+}
+
 func mergeErrors(errs []error) error {
 	if len(errs) == 0 {
 		return nil
@@ -0,0 +1,51 @@
+package nsm
+
+import (
+	"context"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-nsm/internal/metrics"
+	"github.com/layer5io/meshery-nsm/internal/tracing"
+	apitrace "go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+)
+
+// runningOperation is an operation whose outcome is not streamed yet
+type runningOperation struct {
+	name    string
+	started time.Time
+	span    apitrace.Span
+}
+
+// operationStarted records the start of the requested operation in the
+// metrics of the adapter and returns the context of its span
+func (mesh *Mesh) operationStarted(ctx context.Context, opReq adapter.OperationRequest) context.Context {
+	ctx, span := tracing.Start(ctx, "ApplyOperation",
+		label.String("operation", opReq.OperationName),
+		label.String("operation.id", opReq.OperationID),
+		label.String("namespace", opReq.Namespace),
+		label.Bool("delete", opReq.IsDeleteOperation),
+		label.Int("clusters", len(opReq.K8sConfigs)),
+	)
+	metrics.OperationStarted(opReq.OperationName)
+	mesh.running.Store(opReq.OperationID, runningOperation{
+		name:    opReq.OperationName,
+		started: time.Now(),
+		span:    span,
+	})
+	return ctx
+}
+
+// operationFinished records the outcome of the operation in the metrics
+// of the adapter and ends its span, only the first outcome streamed for
+// it is recorded
+func (mesh *Mesh) operationFinished(id string, opErr error) {
+	v, ok := mesh.running.LoadAndDelete(id)
+	if !ok {
+		return
+	}
+	op := v.(runningOperation)
+	metrics.OperationFinished(op.name, op.started, opErr)
+	tracing.End(context.Background(), op.span, opErr)
+}
@@ -0,0 +1,143 @@
+package nsm
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"go.opentelemetry.io/otel/api/global"
+	apitrace "go.opentelemetry.io/otel/api/trace"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/sdk/export/trace/tracetest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/codes"
+)
+
+// unreachableKubeconfig points to a port nothing listens on, so that the
+// requests to the cluster fail right away
+const unreachableKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:1
+contexts:
+- name: test-context
+  context:
+    cluster: test
+    user: test
+current-context: test-context
+users:
+- name: test
+  user:
+    token: test
+`
+
+const configMapManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+`
+
+var (
+	spansOnce sync.Once
+	spans     *tracetest.InMemoryExporter
+)
+
+// recordSpans sets the global trace provider to one recording the ended
+// spans in memory and returns the recorder, emptied
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	spansOnce.Do(func() {
+		spans = tracetest.NewInMemoryExporter()
+		provider, err := sdktrace.NewProvider(
+			sdktrace.WithConfig(sdktrace.Config{DefaultSampler: sdktrace.AlwaysSample()}),
+			sdktrace.WithSyncer(spans),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		global.SetTraceProvider(provider)
+	})
+	spans.Reset()
+	return spans
+}
+
+// spanTree returns the names of the spans by name of their parent, the
+// root spans having an empty parent name
+func spanTree(t *testing.T, sds []*export.SpanData) map[string][]string {
+	t.Helper()
+	names := make(map[apitrace.SpanID]string)
+	for _, sd := range sds {
+		names[sd.SpanContext.SpanID] = sd.Name
+	}
+	tree := make(map[string][]string)
+	for _, sd := range sds {
+		parent := ""
+		if sd.ParentSpanID.IsValid() {
+			var ok bool
+			if parent, ok = names[sd.ParentSpanID]; !ok {
+				t.Fatalf("parent of span %q was not recorded", sd.Name)
+			}
+		}
+		tree[parent] = append(tree[parent], sd.Name)
+	}
+	return tree
+}
+
+func TestOperationSpans(t *testing.T) {
+	tests := []struct {
+		name  string
+		apply func(mesh *Mesh, ctx context.Context) error
+		child string
+	}{
+		{
+			name: "manifest",
+			apply: func(mesh *Mesh, ctx context.Context) error {
+				ctx = withManifestApply(ctx, manifestApply{Strict: true})
+				return mesh.applyManifestToCluster(ctx, clusterName(0), unreachableKubeconfig, []byte(configMapManifest), false, "default")
+			},
+			child: "manifest.apply",
+		},
+		{
+			name: "helm uninstall",
+			apply: func(mesh *Mesh, ctx context.Context) error {
+				return mesh.applyHelmChartToCluster(ctx, clusterName(0), unreachableKubeconfig, "nsm", "v1.6.0", "nsm-system", nil, true)
+			},
+			child: "helm.uninstall",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := recordSpans(t)
+			mesh := &Mesh{}
+			ctx := mesh.operationStarted(context.Background(), adapter.OperationRequest{
+				OperationName: "test",
+				OperationID:   "test-id",
+			})
+			err := tt.apply(mesh, ctx)
+			if err == nil {
+				t.Fatal("expected the unreachable cluster to fail the operation")
+			}
+			mesh.operationFinished("test-id", err)
+
+			sds := recorder.GetSpans()
+			tree := spanTree(t, sds)
+			for parent, want := range map[string]string{
+				"":               "ApplyOperation",
+				"ApplyOperation": "cluster",
+				"cluster":        tt.child,
+			} {
+				if got := tree[parent]; len(got) != 1 || got[0] != want {
+					t.Errorf("children of %q = %v, want [%s]", parent, got, want)
+				}
+			}
+			for _, sd := range sds {
+				if sd.StatusCode != codes.Internal {
+					t.Errorf("status of span %q = %v, want %v", sd.Name, sd.StatusCode, codes.Internal)
+				}
+			}
+		})
+	}
+}
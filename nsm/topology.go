@@ -0,0 +1,303 @@
+package nsm
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// nscAnnotation is the annotation of the pods requesting network services
+const nscAnnotation = "networkservicemesh.io"
+
+// Kinds of the nodes of the topology graph
+const (
+	topologyClient         = "client"
+	topologyNetworkService = "networkService"
+	topologyEndpoint       = "endpoint"
+	topologyForwarder      = "forwarder"
+)
+
+// Relations of the edges of the topology graph
+const (
+	// topologyRequests links a client to the network service it requests
+	topologyRequests = "requests"
+	// topologyProvides links an endpoint to the network service it provides
+	topologyProvides = "provides"
+	// topologyForwards links a forwarder to the clients and endpoints
+	// running on its node
+	topologyForwards = "forwards"
+)
+
+var (
+	networkServicesResource = schema.GroupVersionResource{
+		Group:    "networkservicemesh.io",
+		Version:  "v1",
+		Resource: "networkservices",
+	}
+	networkServiceEndpointsResource = schema.GroupVersionResource{
+		Group:    "networkservicemesh.io",
+		Version:  "v1",
+		Resource: "networkserviceendpoints",
+	}
+)
+
+// topologyNode is a client, network service, endpoint or forwarder of the
+// topology graph. Its ID is unique across the clusters
+type topologyNode struct {
+	ID        string            `json:"id"`
+	Kind      string            `json:"kind"`
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	Cluster   string            `json:"cluster"`
+	Node      string            `json:"node,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// topologyEdge links two nodes of the topology graph
+type topologyEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Relation string `json:"relation"`
+	// Mechanism is the mechanism of the requested connection, such as
+	// kernel or memif
+	Mechanism string `json:"mechanism,omitempty"`
+}
+
+// topologyGraph is the graph of the network service connections
+type topologyGraph struct {
+	Nodes []topologyNode `json:"nodes"`
+	Edges []topologyEdge `json:"edges"`
+}
+
+// topologyID returns the ID of the node of the graph
+func topologyID(cluster, kind, namespace, name string) string {
+	return strings.Join([]string{cluster, kind, namespace, name}, "/")
+}
+
+// inspectTopology builds the graph of the clients, network services,
+// endpoints and forwarders of the NSM install in the namespace of each of
+// the clusters. The network services and endpoints are read from the
+// custom resources of the NSM registry and the clients from the
+// annotations of their pods
+func (mesh *Mesh) inspectTopology(ctx context.Context, namespace string, kubeconfigs []string) (*topologyGraph, error) {
+	var wg sync.WaitGroup
+	var errs []error
+	var mx sync.Mutex
+	graph := &topologyGraph{Nodes: []topologyNode{}, Edges: []topologyEdge{}}
+	for i, config := range kubeconfigs {
+		wg.Add(1)
+		go func(cluster, config string) {
+			defer wg.Done()
+			g, err := clusterTopology(ctx, kubeContextName(config, cluster), config, namespace)
+			mx.Lock()
+			defer mx.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			graph.Nodes = append(graph.Nodes, g.Nodes...)
+			graph.Edges = append(graph.Edges, g.Edges...)
+		}(clusterName(i), config)
+	}
+	wg.Wait()
+
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].ID < graph.Nodes[j].ID })
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+	if len(errs) != 0 {
+		return graph, ErrInspectTopology(mergeErrors(errs))
+	}
+	return graph, nil
+}
+
+// clusterTopology builds the topology graph of a single cluster
+func clusterTopology(ctx context.Context, cluster, config, namespace string) (*topologyGraph, error) {
+	kClient, err := mesherykube.New([]byte(config))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", cluster, err)
+	}
+
+	graph := &topologyGraph{}
+	services := make(map[string]string)
+	addService := func(name string) string {
+		if id, ok := services[name]; ok {
+			return id
+		}
+		id := topologyID(cluster, topologyNetworkService, namespace, name)
+		services[name] = id
+		graph.Nodes = append(graph.Nodes, topologyNode{
+			ID:        id,
+			Kind:      topologyNetworkService,
+			Name:      name,
+			Namespace: namespace,
+			Cluster:   cluster,
+		})
+		return id
+	}
+
+	nss, err := listCustomResources(ctx, kClient, networkServicesResource, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", cluster, err)
+	}
+	for _, ns := range nss {
+		addService(ns.GetName())
+	}
+
+	pods, err := kClient.KubeClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", cluster, err)
+	}
+	podNodes := make(map[string]string)
+	forwarders := make(map[string]string)
+	var workloads []topologyNode
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		podNodes[pod.Namespace+"/"+pod.Name] = pod.Spec.NodeName
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+
+		if pod.Namespace == namespace && strings.HasPrefix(pod.Name, "forwarder") {
+			id := topologyID(cluster, topologyForwarder, pod.Namespace, pod.Name)
+			forwarders[pod.Spec.NodeName] = id
+			graph.Nodes = append(graph.Nodes, topologyNode{
+				ID:        id,
+				Kind:      topologyForwarder,
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+				Cluster:   cluster,
+				Node:      pod.Spec.NodeName,
+			})
+			continue
+		}
+
+		requests, ok := pod.Annotations[nscAnnotation]
+		if !ok {
+			continue
+		}
+		client := topologyNode{
+			ID:        topologyID(cluster, topologyClient, pod.Namespace, pod.Name),
+			Kind:      topologyClient,
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			Cluster:   cluster,
+			Node:      pod.Spec.NodeName,
+		}
+		graph.Nodes = append(graph.Nodes, client)
+		workloads = append(workloads, client)
+		for _, req := range parseNSCRequests(requests) {
+			graph.Edges = append(graph.Edges, topologyEdge{
+				From:      client.ID,
+				To:        addService(req.service),
+				Relation:  topologyRequests,
+				Mechanism: req.mechanism,
+			})
+		}
+	}
+
+	nses, err := listCustomResources(ctx, kClient, networkServiceEndpointsResource, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", cluster, err)
+	}
+	for _, nse := range nses {
+		// The endpoints are registered with the name of their pod, which
+		// may run in any namespace
+		var node string
+		for key, n := range podNodes {
+			if strings.HasSuffix(key, "/"+nse.GetName()) {
+				node = n
+				break
+			}
+		}
+		endpoint := topologyNode{
+			ID:        topologyID(cluster, topologyEndpoint, nse.GetNamespace(), nse.GetName()),
+			Kind:      topologyEndpoint,
+			Name:      nse.GetName(),
+			Namespace: nse.GetNamespace(),
+			Cluster:   cluster,
+			Node:      node,
+		}
+		labels, _, _ := unstructured.NestedStringMap(nse.Object, "metadata", "labels")
+		endpoint.Labels = labels
+		graph.Nodes = append(graph.Nodes, endpoint)
+		workloads = append(workloads, endpoint)
+
+		names, _, _ := unstructured.NestedStringSlice(nse.Object, "spec", "network_service_names")
+		for _, name := range names {
+			graph.Edges = append(graph.Edges, topologyEdge{
+				From:     endpoint.ID,
+				To:       addService(name),
+				Relation: topologyProvides,
+			})
+		}
+	}
+
+	// The connections of the clients and endpoints go through the
+	// forwarder of their node
+	for _, w := range workloads {
+		if id, ok := forwarders[w.Node]; ok && w.Node != "" {
+			graph.Edges = append(graph.Edges, topologyEdge{
+				From:     id,
+				To:       w.ID,
+				Relation: topologyForwards,
+			})
+		}
+	}
+	return graph, nil
+}
+
+// listCustomResources lists the custom resources in the namespace, none
+// if their CRD is not installed
+func listCustomResources(ctx context.Context, kClient *mesherykube.Client, gvr schema.GroupVersionResource, namespace string) ([]unstructured.Unstructured, error) {
+	list, err := kClient.DynamicKubeClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if kubeerror.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// nscRequest is a network service requested by a client
+type nscRequest struct {
+	service   string
+	mechanism string
+}
+
+// parseNSCRequests parses the comma separated network service URLs of the
+// client annotation, e.g. "kernel://my-service/nsm-1" or, for interdomain
+// services, "kernel://my-service@my.domain/nsm-1"
+func parseNSCRequests(annotation string) []nscRequest {
+	var requests []nscRequest
+	for _, raw := range strings.Split(annotation, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		service := u.Host
+		if u.User != nil {
+			service = u.User.Username() + "@" + u.Host
+		}
+		requests = append(requests, nscRequest{service: service, mechanism: u.Scheme})
+	}
+	return requests
+}
@@ -0,0 +1,50 @@
+package nsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNSCRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		want       []nscRequest
+	}{
+		{
+			name:       "single service",
+			annotation: "kernel://my-service/nsm-1",
+			want:       []nscRequest{{service: "my-service", mechanism: "kernel"}},
+		},
+		{
+			name:       "interdomain service",
+			annotation: "kernel://my-service@my.domain/nsm-1",
+			want:       []nscRequest{{service: "my-service@my.domain", mechanism: "kernel"}},
+		},
+		{
+			name:       "several services",
+			annotation: "kernel://vl3/nsm-1, memif://vpn/nsm-2",
+			want: []nscRequest{
+				{service: "vl3", mechanism: "kernel"},
+				{service: "vpn", mechanism: "memif"},
+			},
+		},
+		{
+			name:       "invalid entries are skipped",
+			annotation: "kernel://my-service/nsm-1,,my-service,kernel://%zz/nsm-1",
+			want:       []nscRequest{{service: "my-service", mechanism: "kernel"}},
+		},
+		{
+			name:       "empty annotation",
+			annotation: "",
+			want:       nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseNSCRequests(tt.annotation); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNSCRequests(%q) = %v, want %v", tt.annotation, got, tt.want)
+			}
+		})
+	}
+}
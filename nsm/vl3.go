@@ -0,0 +1,326 @@
+package nsm
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"net"
+	"regexp"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// vl3ImageTag is the tag of the vL3 images when the installed NSM
+	// version is not found
+	vl3ImageTag = "v1.6.1"
+
+	// vl3ReadyTimeout is the time to wait for the vL3 NSEs to be assigned
+	// their prefixes by vl3-ipam
+	vl3ReadyTimeout = 2 * time.Minute
+
+	// vl3ClientPrefixLen is the length of the prefixes handed out by
+	// vl3-ipam to each of the vL3 NSEs
+	vl3ClientPrefixLen = 24
+)
+
+// vl3Template is the manifest of a vL3 network on a single cluster
+var vl3Template = template.Must(template.New("vl3").Parse(`---
+apiVersion: networkservicemesh.io/v1
+kind: NetworkService
+metadata:
+  name: {{ .Name }}
+spec:
+  payload: IP
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Name }}-ipam
+  labels:
+    app: {{ .Name }}-ipam
+spec:
+  selector:
+    matchLabels:
+      app: {{ .Name }}-ipam
+  template:
+    metadata:
+      labels:
+        app: {{ .Name }}-ipam
+    spec:
+      containers:
+        - name: vl3-ipam
+          image: ghcr.io/networkservicemesh/cmd-ipam-vl3:{{ .Tag }}
+          imagePullPolicy: IfNotPresent
+          ports:
+            - containerPort: 5006
+          env:
+            - name: NSM_PREFIX
+              value: {{ .Prefix }}
+            - name: NSM_CLIENT_PREFIX_LEN
+              value: "{{ .ClientPrefixLen }}"
+            - name: NSM_LISTEN_ON
+              value: tcp://:5006
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Name }}-ipam
+spec:
+  selector:
+    app: {{ .Name }}-ipam
+  ports:
+    - name: ipam
+      protocol: TCP
+      port: 5006
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Name }}-nse
+  labels:
+    app: {{ .Name }}-nse
+spec:
+  replicas: {{ .Replicas }}
+  selector:
+    matchLabels:
+      app: {{ .Name }}-nse
+  template:
+    metadata:
+      labels:
+        app: {{ .Name }}-nse
+    spec:
+      containers:
+        - name: nse
+          image: ghcr.io/networkservicemesh/cmd-nse-vl3-vpp:{{ .Tag }}
+          imagePullPolicy: IfNotPresent
+          env:
+            - name: NSM_SERVICE_NAMES
+              value: {{ .Name }}
+            - name: NSM_REGISTER_SERVICE
+              value: "false"
+            - name: NSM_PREFIX_SERVER_URL
+              value: {{ .Name }}-ipam:5006
+            - name: NSM_NAME
+              valueFrom:
+                fieldRef:
+                  fieldPath: metadata.name
+            - name: SPIFFE_ENDPOINT_SOCKET
+              value: unix:///run/spire/sockets/agent.sock
+            - name: NSM_CONNECT_TO
+              value: unix:///var/lib/networkservicemesh/nsm.io.sock
+          volumeMounts:
+            - name: spire-agent-socket
+              mountPath: /run/spire/sockets
+              readOnly: true
+            - name: nsm-socket
+              mountPath: /var/lib/networkservicemesh
+              readOnly: true
+      volumes:
+        - name: spire-agent-socket
+          hostPath:
+            path: /run/spire/sockets
+            type: Directory
+        - name: nsm-socket
+          hostPath:
+            path: /var/lib/networkservicemesh
+            type: DirectoryOrCreate
+`))
+
+// vl3AddressRegexp matches the addresses of the interfaces of a vL3 NSE in
+// the output of vppctl show interface address
+var vl3AddressRegexp = regexp.MustCompile(`L3 (\d+\.\d+\.\d+\.\d+)/\d+`)
+
+// vl3Network describes the vL3 network deployed on a single cluster
+type vl3Network struct {
+	Name            string
+	Prefix          string
+	ClientPrefixLen int
+	Replicas        int
+	Tag             string
+}
+
+// vl3Allocation is the allocation of the addresses of the vL3 network on
+// a cluster
+type vl3Allocation struct {
+	// Prefix is the prefix of the CIDR handed to the vl3-ipam of the cluster
+	Prefix string `json:"prefix"`
+	// NSEs are the prefixes vl3-ipam assigned to each of the NSEs, keyed
+	// by the NSE pod and read back from the NSEs
+	NSEs map[string]string `json:"nses,omitempty"`
+	// Error is the reason the assigned prefixes could not be read back
+	Error string `json:"error,omitempty"`
+}
+
+// deployVL3Network deploys the vL3 network on the cluster and returns its
+// allocation keyed by the cluster name, along with the prefixes the NSEs
+// were assigned.
+//
+// The network has its own vl3-ipam and NSEs, which only serve the clients of
+// the cluster, so deploying it on several clusters is rejected rather than
+// creating separate networks. Removing it is accepted on any number of
+// clusters. A vL3 network spanning clusters requires an interdomain setup
+// sharing a single vl3-ipam, which is not deployed by the adapter
+func (mesh *Mesh) deployVL3Network(ctx context.Context, del bool, name, namespace, cidr string, replicas int, kubeconfigs []string) (string, map[string]vl3Allocation, error) {
+	st := status.Deploying
+	if del {
+		st = status.Removing
+	}
+
+	if len(kubeconfigs) > 1 && !del {
+		return st, nil, ErrVL3Network(fmt.Errorf("a vL3 network is deployed on a single cluster, %d clusters were requested", len(kubeconfigs)))
+	}
+	if replicas < 1 {
+		return st, nil, ErrVL3Network(fmt.Errorf("replica count must be at least 1, got %d", replicas))
+	}
+
+	prefixes, err := splitCIDR(cidr, len(kubeconfigs))
+	if err != nil {
+		return st, nil, ErrVL3Network(err)
+	}
+
+	var wg sync.WaitGroup
+	var errs []error
+	var mx sync.Mutex
+	allocated := make(map[string]vl3Allocation)
+	for i, config := range kubeconfigs {
+		wg.Add(1)
+		go func(i int, config string) {
+			defer wg.Done()
+			allocation := vl3Allocation{Prefix: prefixes[i]}
+			kClient, err := mesherykube.New([]byte(config))
+			if err == nil {
+				var manifest bytes.Buffer
+				err = vl3Template.Execute(&manifest, vl3Network{
+					Name:            name,
+					Prefix:          prefixes[i],
+					ClientPrefixLen: vl3ClientPrefixLen,
+					Replicas:        replicas,
+					Tag:             nsmImageTag(ctx, kClient, vl3ImageTag),
+				})
+				if err == nil {
+					err = mesh.applyManifestToCluster(ctx, clusterName(i), config, manifest.Bytes(), del, namespace)
+				}
+			}
+			if err == nil && !del && dryRunFrom(ctx) == nil {
+				allocation.NSEs, err = vl3AssignedPrefixes(ctx, kClient, namespace, name, prefixes[i], replicas)
+				if err != nil {
+					allocation.Error = err.Error()
+					err = nil
+				}
+			}
+
+			mx.Lock()
+			defer mx.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s", clusterName(i), err))
+				return
+			}
+			allocated[clusterName(i)] = allocation
+		}(i, config)
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return st, allocated, ErrVL3Network(mergeErrors(errs))
+	}
+
+	if del {
+		return status.Removed, allocated, nil
+	}
+	return status.Deployed, allocated, nil
+}
+
+// vl3AssignedPrefixes waits for the running vL3 NSEs of the cluster to be
+// assigned their prefixes by vl3-ipam and returns them keyed by the NSE
+// pod. The prefixes read back until the timeout are returned along with
+// the error when not all of the NSEs report one
+func vl3AssignedPrefixes(ctx context.Context, kClient *mesherykube.Client, namespace, name, prefix string, replicas int) (map[string]string, error) {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	assigned := make(map[string]string)
+	err = wait.PollImmediate(5*time.Second, vl3ReadyTimeout, func() (bool, error) {
+		pods, err := kClient.KubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: "app=" + name + "-nse",
+		})
+		if err != nil {
+			return false, nil
+		}
+		for _, pod := range pods.Items {
+			if _, ok := assigned[pod.Name]; ok || pod.Status.Phase != corev1.PodRunning {
+				continue
+			}
+			out, err := execInPod(kClient, namespace, pod.Name, "nse", []string{"vppctl", "show", "interface", "address"}, nil)
+			if err != nil {
+				continue
+			}
+			if p := vl3NSEPrefix(out, network); p != "" {
+				assigned[pod.Name] = p
+			}
+		}
+		return len(assigned) >= replicas, nil
+	})
+	if err != nil {
+		return assigned, fmt.Errorf("%d of %d NSEs reported their prefix: %s", len(assigned), replicas, err)
+	}
+	return assigned, nil
+}
+
+// vl3NSEPrefix returns the prefix assigned to the vL3 NSE, from the output
+// of vppctl show interface address, which lists the address of the NSE in
+// its prefix. Only the addresses in the prefix of the cluster are taken
+func vl3NSEPrefix(out string, network *net.IPNet) string {
+	mask := net.CIDRMask(vl3ClientPrefixLen, 32)
+	for _, m := range vl3AddressRegexp.FindAllStringSubmatch(out, -1) {
+		ip := net.ParseIP(m[1]).To4()
+		if ip == nil || !network.Contains(ip) {
+			continue
+		}
+		return fmt.Sprintf("%s/%d", ip.Mask(mask), vl3ClientPrefixLen)
+	}
+	return ""
+}
+
+// splitCIDR splits the IPv4 CIDR into n equally sized prefixes, rounding n
+// up to the next power of two
+func splitCIDR(cidr string, n int) ([]string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	ip := network.IP.To4()
+	if ip == nil {
+		return nil, fmt.Errorf("%s is not an IPv4 CIDR", cidr)
+	}
+	if n < 1 {
+		return nil, fmt.Errorf("no clusters to allocate %s to", cidr)
+	}
+
+	ones, _ := network.Mask.Size()
+	prefixLen := ones + bits.Len(uint(n-1))
+	if prefixLen > vl3ClientPrefixLen {
+		return nil, fmt.Errorf("%s is too small to allocate a /%d to each of the %d clusters", cidr, vl3ClientPrefixLen, n)
+	}
+
+	base := binary.BigEndian.Uint32(ip)
+	size := uint32(1) << (32 - prefixLen)
+	prefixes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		sub := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(sub, base+uint32(i)*size)
+		prefixes = append(prefixes, fmt.Sprintf("%s/%d", sub, prefixLen))
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,89 @@
+package nsm
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestSplitCIDR(t *testing.T) {
+	tests := []struct {
+		name    string
+		cidr    string
+		n       int
+		want    []string
+		wantErr bool
+	}{
+		{name: "single cluster", cidr: "172.16.0.0/16", n: 1, want: []string{"172.16.0.0/16"}},
+		{name: "two clusters", cidr: "172.16.0.0/16", n: 2, want: []string{"172.16.0.0/17", "172.16.128.0/17"}},
+		{name: "rounded up", cidr: "172.16.0.0/16", n: 3, want: []string{"172.16.0.0/18", "172.16.64.0/18", "172.16.128.0/18"}},
+		{name: "too small", cidr: "172.16.0.0/24", n: 2, wantErr: true},
+		{name: "IPv6", cidr: "fd00::/64", n: 1, wantErr: true},
+		{name: "no clusters", cidr: "172.16.0.0/16", n: 0, wantErr: true},
+		{name: "invalid", cidr: "172.16.0.0", n: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitCIDR(tt.cidr, tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitCIDR() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCIDR() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVL3NSEPrefix(t *testing.T) {
+	_, network, err := net.ParseCIDR("172.16.0.0/17")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		out  string
+		want string
+	}{
+		{
+			name: "address of the NSE",
+			out: `local0 (dn):
+host-eth0 (up):
+  L3 10.244.1.7/24
+loop0 (up):
+  L3 172.16.3.0/32`,
+			want: "172.16.3.0/24",
+		},
+		{
+			name: "address outside of the prefix of the cluster",
+			out: `loop0 (up):
+  L3 172.16.200.0/32`,
+			want: "",
+		},
+		{
+			name: "no address",
+			out:  "local0 (dn):",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := vl3NSEPrefix(tt.out, network); got != tt.want {
+				t.Errorf("vl3NSEPrefix() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeployVL3NetworkClusters(t *testing.T) {
+	mesh := &Mesh{}
+	_, allocations, err := mesh.deployVL3Network(context.Background(), false, "vl3", "default", "172.16.0.0/16", 2, []string{"cluster-0", "cluster-1"})
+	if err == nil {
+		t.Fatal("expected a vL3 network on two clusters to be rejected")
+	}
+	if len(allocations) != 0 {
+		t.Errorf("allocated %v, want nothing", allocations)
+	}
+}